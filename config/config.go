@@ -3,46 +3,197 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cnosuke/mcp-gemini-grounded-search/internal/prompt"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 )
 
+// Backend names accepted by gemini.backend
+const (
+	BackendGemini = "gemini"
+	BackendFake   = "fake"
+)
+
+// Cassette modes accepted by gemini.cassette.mode
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// Key rotation strategies accepted by gemini.key_rotation
+const (
+	KeyRotationRoundRobin = "round_robin"
+	KeyRotationFailover   = "failover"
+)
+
+// Cache types accepted by cache.type
+const (
+	CacheMemory = "memory"
+	CacheDisk   = "disk"
+)
+
+// Output formats accepted by tools.output_format
+const (
+	OutputFormatJSON     = "json"
+	OutputFormatMarkdown = "markdown"
+	OutputFormatText     = "text"
+)
+
+// BudgetLimits - Request and token limits per UTC day and month. Zero means unlimited.
+type BudgetLimits struct {
+	DailyRequests   int `koanf:"daily_requests"`
+	DailyTokens     int `koanf:"daily_tokens"`
+	MonthlyRequests int `koanf:"monthly_requests"`
+	MonthlyTokens   int `koanf:"monthly_tokens"`
+}
+
+// Enabled - Whether any limit is set
+func (l BudgetLimits) Enabled() bool {
+	return l.DailyRequests > 0 || l.DailyTokens > 0 || l.MonthlyRequests > 0 || l.MonthlyTokens > 0
+}
+
+// DefaultTemplateName - Name under which gemini.query_template is available
+const DefaultTemplateName = "default"
+
 // Config - Application configuration
 type Config struct {
 	Log    string `koanf:"log"`
 	Debug  bool   `koanf:"debug"`
 	Gemini struct {
-		APIKey         string `koanf:"api_key"`
-		ModelName      string `koanf:"model_name"`
-		MaxTokens      int    `koanf:"max_tokens"`
-		QueryTemplate  string `koanf:"query_template"`
-		ThinkingLevel  string `koanf:"thinking_level"`
-		ThinkingBudget *int   `koanf:"thinking_budget"`
+		Backend           string            `koanf:"backend"`
+		FixturesDir       string            `koanf:"fixtures_dir"`
+		APIKey            string            `koanf:"api_key"`
+		APIKeys           []string          `koanf:"api_keys"`
+		KeyRotation       string            `koanf:"key_rotation"`
+		KeyBenchSeconds   int               `koanf:"key_bench_seconds"`
+		ModelName         string            `koanf:"model_name"`
+		FallbackModels    []string          `koanf:"fallback_models"`
+		MaxTokens         int               `koanf:"max_tokens"`
+		QueryTemplate     string            `koanf:"query_template"`
+		QueryTemplates    map[string]string `koanf:"query_templates"`
+		DefaultTemplate   string            `koanf:"default_template"`
+		Locale            string            `koanf:"locale"`
+		Timezone          string            `koanf:"timezone"`
+		DatePreamble      bool              `koanf:"date_preamble"`
+		ThinkingLevel     string            `koanf:"thinking_level"`
+		ThinkingBudget    *int              `koanf:"thinking_budget"`
+		TimeoutSeconds    int               `koanf:"timeout_seconds"`
+		MaxTimeoutSeconds int               `koanf:"max_timeout_seconds"`
+		Retry             struct {
+			MaxAttempts int     `koanf:"max_attempts"`
+			BaseDelayMs int     `koanf:"base_delay_ms"`
+			MaxDelayMs  int     `koanf:"max_delay_ms"`
+			Jitter      float64 `koanf:"jitter"`
+		} `koanf:"retry"`
+		RateLimit struct {
+			RequestsPerMinute int `koanf:"requests_per_minute"`
+			Burst             int `koanf:"burst"`
+			MaxConcurrent     int `koanf:"max_concurrent"`
+			MaxWaitSeconds    int `koanf:"max_wait_seconds"`
+		} `koanf:"rate_limit"`
+		Cassette struct {
+			Mode string `koanf:"mode"`
+			Path string `koanf:"path"`
+		} `koanf:"cassette"`
+		SourceFilter struct {
+			Allow []string `koanf:"allow"`
+			Deny  []string `koanf:"deny"`
+		} `koanf:"source_filter"`
+		URLResolver struct {
+			Enabled         bool     `koanf:"enabled"`
+			Hosts           []string `koanf:"hosts"`
+			TimeoutSeconds  int      `koanf:"timeout_seconds"`
+			MaxConcurrent   int      `koanf:"max_concurrent"`
+			MaxRedirects    int      `koanf:"max_redirects"`
+			CacheTTLSeconds int      `koanf:"cache_ttl_seconds"`
+			CacheMaxEntries int      `koanf:"cache_max_entries"`
+		} `koanf:"url_resolver"`
 	} `koanf:"gemini"`
+	Cache struct {
+		Type       string `koanf:"type"`
+		TTLSeconds int    `koanf:"ttl_seconds"`
+		MaxEntries int    `koanf:"max_entries"`
+		Dir        string `koanf:"dir"`
+	} `koanf:"cache"`
+	Tools struct {
+		BatchConcurrency  int    `koanf:"batch_concurrency"`
+		MaxBatchQuestions int    `koanf:"max_batch_questions"`
+		InlineCitations   bool   `koanf:"inline_citations"`
+		OutputFormat      string `koanf:"output_format"`
+		SearchSuggestions bool   `koanf:"search_suggestions"`
+	} `koanf:"tools"`
+	Credibility struct {
+		File string `koanf:"file"`
+	} `koanf:"credibility"`
+	Budget struct {
+		StatePath string       `koanf:"state_path"`
+		Global    BudgetLimits `koanf:"global"`
+		PerToken  BudgetLimits `koanf:"per_token"`
+	} `koanf:"budget"`
+	Usage struct {
+		RetentionDays int `koanf:"retention_days"`
+	} `koanf:"usage"`
+	Conversations struct {
+		TTLSeconds    int `koanf:"ttl_seconds"`
+		MaxTurns      int `koanf:"max_turns"`
+		MaxPerSession int `koanf:"max_per_session"`
+	} `koanf:"conversations"`
 	HTTP struct {
-		Port             int      `koanf:"port"`
-		EndpointPath     string   `koanf:"endpoint_path"`
-		AuthToken        string   `koanf:"auth_token"`
-		AllowedOrigins   []string `koanf:"allowed_origins"`
-		HeartbeatSeconds int      `koanf:"heartbeat_seconds"`
+		Port             int               `koanf:"port"`
+		EndpointPath     string            `koanf:"endpoint_path"`
+		AuthToken        string            `koanf:"auth_token"`
+		AuthTokens       map[string]string `koanf:"auth_tokens"`
+		AllowedOrigins   []string          `koanf:"allowed_origins"`
+		HeartbeatSeconds int               `koanf:"heartbeat_seconds"`
 	} `koanf:"http"`
 }
 
 func defaultValues() map[string]any {
 	return map[string]any{
-		"log":                    "",
-		"debug":                  false,
-		"gemini.model_name":      "gemini-3.6-flash",
-		"gemini.max_tokens":      5000,
-		"gemini.thinking_level":  "",
-		"http.port":              8080,
-		"http.endpoint_path":     "/mcp",
-		"http.heartbeat_seconds": 30,
+		"log":                                   "",
+		"debug":                                 false,
+		"gemini.backend":                        BackendGemini,
+		"gemini.key_rotation":                   KeyRotationRoundRobin,
+		"gemini.key_bench_seconds":              60,
+		"gemini.model_name":                     "gemini-3.6-flash",
+		"gemini.max_tokens":                     5000,
+		"gemini.thinking_level":                 "",
+		"gemini.timeout_seconds":                120,
+		"gemini.max_timeout_seconds":            300,
+		"gemini.default_template":               DefaultTemplateName,
+		"gemini.timezone":                       "UTC",
+		"gemini.retry.max_attempts":             3,
+		"gemini.retry.base_delay_ms":            500,
+		"gemini.retry.max_delay_ms":             10000,
+		"gemini.retry.jitter":                   0.2,
+		"gemini.rate_limit.burst":               1,
+		"gemini.rate_limit.max_wait_seconds":    30,
+		"gemini.url_resolver.hosts":             []string{"vertexaisearch.cloud.google.com"},
+		"gemini.url_resolver.timeout_seconds":   5,
+		"gemini.url_resolver.max_concurrent":    8,
+		"gemini.url_resolver.max_redirects":     5,
+		"gemini.url_resolver.cache_ttl_seconds": 86400,
+		"gemini.url_resolver.cache_max_entries": 10000,
+		"cache.ttl_seconds":                     3600,
+		"cache.max_entries":                     1000,
+		"tools.batch_concurrency":               4,
+		"tools.max_batch_questions":             10,
+		"tools.output_format":                   OutputFormatJSON,
+		"budget.state_path":                     "mcp-gemini-grounded-search-budget.json",
+		"usage.retention_days":                  30,
+		"conversations.ttl_seconds":             1800,
+		"conversations.max_turns":               10,
+		"conversations.max_per_session":         50,
+		"http.port":                             8080,
+		"http.endpoint_path":                    "/mcp",
+		"http.heartbeat_seconds":                30,
 	}
 }
 
@@ -54,12 +205,66 @@ func envOverrides() map[string]any {
 	if v := os.Getenv("DEBUG"); v != "" {
 		m["debug"] = v == "true" || v == "1"
 	}
+	if v := os.Getenv("GEMINI_BACKEND"); v != "" {
+		m["gemini.backend"] = v
+	}
+	if v := os.Getenv("GEMINI_FIXTURES_DIR"); v != "" {
+		m["gemini.fixtures_dir"] = v
+	}
+	if v := os.Getenv("GEMINI_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["gemini.timeout_seconds"] = n
+		}
+	}
+	if v := os.Getenv("GEMINI_RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["gemini.retry.max_attempts"] = n
+		}
+	}
+	if v := os.Getenv("GEMINI_RATE_LIMIT_RPM"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["gemini.rate_limit.requests_per_minute"] = n
+		}
+	}
+	if v := os.Getenv("GEMINI_RESOLVE_URLS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			m["gemini.url_resolver.enabled"] = b
+		}
+	}
+	if v := os.Getenv("GEMINI_LOCALE"); v != "" {
+		m["gemini.locale"] = v
+	}
+	if v := os.Getenv("GEMINI_TIMEZONE"); v != "" {
+		m["gemini.timezone"] = v
+	}
+	if v := os.Getenv("GEMINI_DATE_PREAMBLE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			m["gemini.date_preamble"] = b
+		}
+	}
+	if v := os.Getenv("GEMINI_MAX_CONCURRENT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["gemini.rate_limit.max_concurrent"] = n
+		}
+	}
+	if v := os.Getenv("GEMINI_CASSETTE_MODE"); v != "" {
+		m["gemini.cassette.mode"] = v
+	}
+	if v := os.Getenv("GEMINI_CASSETTE_PATH"); v != "" {
+		m["gemini.cassette.path"] = v
+	}
 	if v := os.Getenv("GEMINI_API_KEY"); v != "" {
 		m["gemini.api_key"] = v
 	}
+	if v := os.Getenv("GEMINI_API_KEYS"); v != "" {
+		m["gemini.api_keys"] = strings.Split(v, ",")
+	}
 	if v := os.Getenv("GEMINI_MODEL_NAME"); v != "" {
 		m["gemini.model_name"] = v
 	}
+	if v := os.Getenv("GEMINI_FALLBACK_MODELS"); v != "" {
+		m["gemini.fallback_models"] = strings.Split(v, ",")
+	}
 	if v := os.Getenv("GEMINI_MAX_TOKENS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			m["gemini.max_tokens"] = n
@@ -71,6 +276,28 @@ func envOverrides() map[string]any {
 	if v := os.Getenv("GEMINI_THINKING_LEVEL"); v != "" {
 		m["gemini.thinking_level"] = v
 	}
+	if v := os.Getenv("CACHE_TYPE"); v != "" {
+		m["cache.type"] = v
+	}
+	if v := os.Getenv("CACHE_DIR"); v != "" {
+		m["cache.dir"] = v
+	}
+	if v := os.Getenv("BUDGET_STATE_PATH"); v != "" {
+		m["budget.state_path"] = v
+	}
+	if v := os.Getenv("BUDGET_DAILY_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["budget.global.daily_tokens"] = n
+		}
+	}
+	if v := os.Getenv("BUDGET_MONTHLY_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			m["budget.global.monthly_tokens"] = n
+		}
+	}
+	if v := os.Getenv("OUTPUT_FORMAT"); v != "" {
+		m["tools.output_format"] = v
+	}
 	if v := os.Getenv("HTTP_PORT"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			m["http.port"] = n
@@ -79,6 +306,15 @@ func envOverrides() map[string]any {
 	if v := os.Getenv("HTTP_AUTH_TOKEN"); v != "" {
 		m["http.auth_token"] = v
 	}
+	if v := os.Getenv("HTTP_AUTH_TOKENS"); v != "" {
+		tokens := map[string]any{}
+		for _, pair := range strings.Split(v, ",") {
+			if name, token, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && name != "" && token != "" {
+				tokens[name] = token
+			}
+		}
+		m["http.auth_tokens"] = tokens
+	}
 	if v := os.Getenv("HTTP_ENDPOINT_PATH"); v != "" {
 		m["http.endpoint_path"] = v
 	}
@@ -93,6 +329,51 @@ func envOverrides() map[string]any {
 	return m
 }
 
+// RequiresAPIKey - Whether the selected backend needs a Gemini API key
+func (c *Config) RequiresAPIKey() bool {
+	return c.Gemini.Backend != BackendFake && c.Gemini.Cassette.Mode != CassetteReplay
+}
+
+// APIKeys - All configured Gemini API keys: api_key first, then api_keys, without blanks or duplicates
+func (c *Config) APIKeys() []string {
+	keys := make([]string, 0, len(c.Gemini.APIKeys)+1)
+	for _, k := range append([]string{c.Gemini.APIKey}, c.Gemini.APIKeys...) {
+		k = strings.TrimSpace(k)
+		if k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// FallbackModelNames - Trimmed fallback models without empty entries, duplicates
+// or the primary model. It is computed on use, as the model name may be
+// overridden after the configuration is loaded.
+func (c *Config) FallbackModelNames() []string {
+	primary := strings.TrimSpace(c.Gemini.ModelName)
+	out := make([]string, 0, len(c.Gemini.FallbackModels))
+	for _, m := range c.Gemini.FallbackModels {
+		m = strings.TrimSpace(m)
+		if m != "" && m != primary && !slices.Contains(out, m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// QueryTemplates - Named query templates: gemini.query_templates plus
+// gemini.query_template as "default" unless the map defines that name itself
+func (c *Config) QueryTemplates() map[string]string {
+	templates := make(map[string]string, len(c.Gemini.QueryTemplates)+1)
+	if c.Gemini.QueryTemplate != "" {
+		templates[DefaultTemplateName] = c.Gemini.QueryTemplate
+	}
+	for name, t := range c.Gemini.QueryTemplates {
+		templates[name] = t
+	}
+	return templates
+}
+
 // LoadConfig - Load configuration file
 func LoadConfig(path string) (*Config, error) {
 	k := koanf.New(".")
@@ -124,5 +405,25 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.Gemini.ThinkingBudget = &n
 	}
 
+	templates := cfg.QueryTemplates()
+	for name, t := range templates {
+		if _, err := prompt.Parse(name, t); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := templates[cfg.Gemini.DefaultTemplate]; len(templates) > 0 && !ok {
+		return nil, fmt.Errorf("gemini.default_template %q is not a defined query template", cfg.Gemini.DefaultTemplate)
+	}
+
+	if _, err := time.LoadLocation(cfg.Gemini.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid gemini.timezone %q: %w", cfg.Gemini.Timezone, err)
+	}
+
+	switch cfg.Tools.OutputFormat {
+	case OutputFormatJSON, OutputFormatMarkdown, OutputFormatText:
+	default:
+		return nil, fmt.Errorf("invalid tools.output_format %q: must be json, markdown or text", cfg.Tools.OutputFormat)
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// CredibilityCategory - Category of sources such as academic or forum
+type CredibilityCategory struct {
+	Tier string `koanf:"tier"`
+}
+
+// Credibility - Domain classification table: domains map to categories and
+// categories to trust tiers
+type Credibility struct {
+	Categories map[string]CredibilityCategory `koanf:"categories"`
+	// Domains maps domain patterns to categories. A pattern matches the domain
+	// and its subdomains; the longest matching pattern wins.
+	Domains map[string]string `koanf:"domains"`
+}
+
+// LoadCredibility - Load a domain classification table from a YAML file
+func LoadCredibility(path string) (*Credibility, error) {
+	// Domain keys contain dots, so another delimiter keeps them intact
+	k := koanf.New("::")
+	if err := k.Load(file.Provider(path), yaml.Parser()); err != nil {
+		return nil, err
+	}
+
+	c := &Credibility{}
+	if err := k.Unmarshal("", c); err != nil {
+		return nil, err
+	}
+
+	for name, category := range c.Categories {
+		if category.Tier == "" {
+			return nil, fmt.Errorf("category %q has no tier", name)
+		}
+	}
+	for domain, category := range c.Domains {
+		if _, ok := c.Categories[category]; !ok {
+			return nil, fmt.Errorf("domain %q uses undefined category %q", domain, category)
+		}
+	}
+
+	return c, nil
+}
@@ -11,6 +11,8 @@ require (
 	github.com/mark3labs/mcp-go v0.44.0
 	github.com/urfave/cli/v3 v3.6.2
 	go.uber.org/zap v1.27.1
+	google.golang.org/genai v1.47.0
+	google.golang.org/grpc v1.79.1
 )
 
 require (
@@ -51,9 +53,7 @@ require (
 	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/text v0.34.0 // indirect
 	google.golang.org/api v0.267.0 // indirect
-	google.golang.org/genai v1.47.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20260217215200-42d3e9bedb6d // indirect
-	google.golang.org/grpc v1.79.1 // indirect
 	google.golang.org/protobuf v1.36.11 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,125 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// At - Vars with Date, Time and Timezone set to t in its location
+func At(t time.Time) Vars {
+	return Vars{
+		Date:     t.Format(time.DateOnly),
+		Time:     t.Format("15:04"),
+		Timezone: t.Location().String(),
+	}
+}
+
+// Timeless - Copy of vars with Date and Time replaced by placeholders, so a
+// prompt rendered from it is the same whenever it is built
+func (v Vars) Timeless() Vars {
+	v.Date = "<date>"
+	v.Time = "<time>"
+	return v
+}
+
+// Preamble - Sentence anchoring relative dates in the question to the date and time in vars
+func Preamble(vars Vars) string {
+	return fmt.Sprintf("Current date and time: %s %s (%s). Interpret relative dates such as \"today\", \"this week\" or \"latest\" accordingly.",
+		vars.Date, vars.Time, vars.Timezone)
+}
+
+// Vars - Variables available to query templates as {{.Question}}, {{.Date}},
+// {{.Time}}, {{.Timezone}}, {{.Locale}} and {{.Context}}
+type Vars struct {
+	// Question is the question to answer, including any conversation history
+	Question string
+	// Date is the current date in Timezone as YYYY-MM-DD
+	Date string
+	// Time is the current time in Timezone as HH:MM
+	Time string
+	// Timezone is the IANA name of the timezone Date and Time are given in, such as "Asia/Tokyo"
+	Timezone string
+	// Locale is the preferred answer locale such as "ja-JP", or empty
+	Locale string
+	// Context is extra context supplied by the caller, or empty
+	Context string
+}
+
+// Template - Query template. Templates containing %s are legacy fmt templates
+// where every %s is the question and %% a literal %, so they may contain a
+// literal "{{"; all others use text/template.
+type Template struct {
+	name   string
+	text   string
+	tmpl   *template.Template
+	legacy bool
+}
+
+// Parse - Parse and validate a query template. The template must place the
+// question somewhere in the prompt.
+func Parse(name, text string) (*Template, error) {
+	t := &Template{name: name, text: text}
+
+	if strings.Contains(text, "%s") {
+		t.legacy = true
+	} else {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query template %q: %w", name, err)
+		}
+		t.tmpl = tmpl
+	}
+
+	// Render once so references to unknown variables fail here rather than per search
+	const probe = "\x00question\x00"
+	out, err := t.Execute(Vars{Question: probe, Date: "2006-01-02", Time: "15:04", Timezone: "UTC", Locale: "en-US", Context: "context"})
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(out, probe) {
+		return nil, fmt.Errorf("query template %q must contain {{.Question}} or %%s", name)
+	}
+
+	return t, nil
+}
+
+// Execute - Render the template with vars
+func (t *Template) Execute(vars Vars) (string, error) {
+	if t.legacy {
+		return expandLegacy(t.text, vars.Question), nil
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("failed to render query template %q: %w", t.name, err)
+	}
+	return b.String(), nil
+}
+
+// Text - Source text of the template
+func (t *Template) Text() string {
+	return t.text
+}
+
+// expandLegacy - Substitute question for every %s and unescape %%. Any other %
+// is kept as is instead of producing fmt's %!(...) noise.
+func expandLegacy(text, question string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '%' && i+1 < len(text) {
+			switch text[i+1] {
+			case 's':
+				b.WriteString(question)
+				i++
+				continue
+			case '%':
+				b.WriteByte('%')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"question", "Answer: %s", "Answer: Q"},
+		{"escaped percent", "100%% sure: %s", "100% sure: Q"},
+		{"stray percent", "50% off %d %s", "50% off %d Q"},
+		{"trailing percent", "%s 100%", "Q 100%"},
+		{"several questions", "%s? Again: %s", "Q? Again: Q"},
+		{"escaped before s", "%%s %s", "%s Q"},
+		{"braces", "Reply as {{json}}: %s", "Reply as {{json}}: Q"},
+		{"no question", "plain", "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandLegacy(tt.text, "Q"); got != tt.want {
+				t.Errorf("expandLegacy(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	vars := Vars{Question: "Q", Date: "2026-10-17", Time: "09:30", Timezone: "Asia/Tokyo", Locale: "ja-JP"}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "legacy", text: "Answer briefly. %s", want: "Answer briefly. Q"},
+		{name: "legacy with braces", text: "Format as {{ \"a\": 1 }}: %s", want: "Format as {{ \"a\": 1 }}: Q"},
+		{name: "template", text: "{{.Date}} {{.Time}} {{.Timezone}}: {{.Question}}", want: "2026-10-17 09:30 Asia/Tokyo: Q"},
+		{name: "optional fields", text: "{{if .Locale}}In {{.Locale}}. {{end}}{{.Question}}{{with .Context}} ({{.}}){{end}}", want: "In ja-JP. Q"},
+		{name: "legacy without question", text: "Answer briefly.", wantErr: "must contain"},
+		{name: "template without question", text: "Today is {{.Date}}", wantErr: "must contain"},
+		{name: "question only in a branch", text: "{{if not .Locale}}{{.Question}}{{end}}", wantErr: "must contain"},
+		{name: "unknown field", text: "{{.Topic}} {{.Question}}", wantErr: "can't evaluate field Topic"},
+		{name: "syntax error", text: "{{.Question", wantErr: "invalid query template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.name, tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) err = %v, want it to contain %q", tt.text, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.text, err)
+			}
+			got, err := tmpl.Execute(vars)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeless(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	morning := At(time.Date(2026, 10, 17, 9, 30, 0, 0, loc))
+	evening := At(time.Date(2026, 12, 1, 21, 0, 0, 0, loc))
+	if morning.Timezone != "Asia/Tokyo" || morning.Date != "2026-10-17" || morning.Time != "09:30" {
+		t.Errorf("At() = %+v", morning)
+	}
+	if morning.Timeless() != evening.Timeless() {
+		t.Errorf("Timeless() differs: %+v and %+v", morning.Timeless(), evening.Timeless())
+	}
+}
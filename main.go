@@ -89,7 +89,7 @@ func main() {
 					if cmd.IsSet("thinking-level") {
 						cfg.Gemini.ThinkingLevel = cmd.String("thinking-level")
 					}
-					if cfg.Gemini.APIKey == "" {
+					if cfg.RequiresAPIKey() && len(cfg.APIKeys()) == 0 {
 						return fmt.Errorf("Gemini API key is required. Set it in config.yml or use --api-key flag or GEMINI_API_KEY environment variable")
 					}
 					if err := logger.InitLogger(cfg.Debug, cfg.Log); err != nil {
@@ -115,7 +115,7 @@ func main() {
 					if err != nil {
 						return ierrors.Wrap(err, "failed to load configuration file")
 					}
-					if cfg.Gemini.APIKey == "" {
+					if cfg.RequiresAPIKey() && len(cfg.APIKeys()) == 0 {
 						return fmt.Errorf("Gemini API key is required. Set it in config.yml or GEMINI_API_KEY environment variable")
 					}
 					if err := logger.InitLogger(cfg.Debug, cfg.Log); err != nil {
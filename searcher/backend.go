@@ -0,0 +1,213 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"go.uber.org/zap"
+)
+
+// Backend - Grounded content generation backend used by Searcher.
+// *search.Client satisfies this interface, so other providers and decorators
+// can be swapped in without touching Searcher.
+type Backend interface {
+	GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error)
+}
+
+// callInfo - What happened to the backend call of one search, reported back
+// through the context by the backend layers
+type callInfo struct {
+	// joined is set when the call joined another caller's identical in-flight call
+	joined bool
+	// reached is set once a request was sent to the provider, or served from a cassette
+	reached bool
+}
+
+// callInfoKey - Context key of the callInfo of a search
+type callInfoKey struct{}
+
+// withCallInfo - Context through which backend layers report on the call
+func withCallInfo(ctx context.Context) (context.Context, *callInfo) {
+	info := &callInfo{}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+func callInfoFrom(ctx context.Context) *callInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*callInfo)
+	return info
+}
+
+// markReached - Record that the call reached the provider
+func markReached(ctx context.Context) {
+	if info := callInfoFrom(ctx); info != nil {
+		info.reached = true
+	}
+}
+
+// reachingBackend - Backend decorator around the provider that records that a
+// request got past the local layers such as the rate limiter
+type reachingBackend struct {
+	next Backend
+}
+
+// GenerateGroundedContentWithParams - Mark the call as reached and pass it on
+func (b *reachingBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	markReached(ctx)
+	return b.next.GenerateGroundedContentWithParams(ctx, params)
+}
+
+// newBackend - Create the backend selected by gemini.backend and gemini.cassette
+func newBackend(ctx context.Context, cfg *config.Config) (Backend, error) {
+	// Replay never reaches the network, so it replaces the backend entirely.
+	if cfg.Gemini.Cassette.Mode == config.CassetteReplay {
+		zap.S().Infow("replaying from cassette",
+			"path", cfg.Gemini.Cassette.Path)
+		player, err := newCassettePlayer(cfg.Gemini.Cassette.Path)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to create cassette player")
+		}
+		return player, nil
+	}
+
+	backend, err := newBaseBackend(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	backend = &reachingBackend{next: backend}
+
+	if rl := cfg.Gemini.RateLimit; rl.RequestsPerMinute > 0 || rl.MaxConcurrent > 0 {
+		zap.S().Infow("rate limit enabled",
+			"requests_per_minute", rl.RequestsPerMinute,
+			"burst", rl.Burst,
+			"max_concurrent", rl.MaxConcurrent,
+			"max_wait_seconds", rl.MaxWaitSeconds)
+		backend = newRateLimitedBackend(backend, cfg)
+	}
+
+	// Retries wrap the rate limiter so every attempt is counted against it.
+	if cfg.Gemini.Retry.MaxAttempts > 1 {
+		zap.S().Infow("retry enabled",
+			"max_attempts", cfg.Gemini.Retry.MaxAttempts,
+			"base_delay_ms", cfg.Gemini.Retry.BaseDelayMs,
+			"max_delay_ms", cfg.Gemini.Retry.MaxDelayMs,
+			"jitter", cfg.Gemini.Retry.Jitter)
+		backend = newRetryBackend(backend, cfg)
+	}
+
+	switch cfg.Gemini.Cassette.Mode {
+	case "":
+	case config.CassetteRecord:
+		zap.S().Infow("recording to cassette",
+			"path", cfg.Gemini.Cassette.Path)
+		recorder, err := newCassetteRecorder(backend, cfg.Gemini.Cassette.Path)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to create cassette recorder")
+		}
+		backend = recorder
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", cfg.Gemini.Cassette.Mode)
+	}
+
+	// Coalescing is outermost so identical concurrent requests share one
+	// upstream call, including its retries.
+	return newCoalescingBackend(backend), nil
+}
+
+// newBaseBackend - Create the provider backend selected by gemini.backend
+func newBaseBackend(ctx context.Context, cfg *config.Config) (Backend, error) {
+	switch cfg.Gemini.Backend {
+	case "", config.BackendGemini:
+		return newGeminiBackend(ctx, cfg)
+	case config.BackendFake:
+		zap.S().Infow("using fake backend",
+			"fixtures_dir", cfg.Gemini.FixturesDir)
+		fake, err := newFakeBackend(cfg.Gemini.FixturesDir)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to create fake backend")
+		}
+		return fake, nil
+	default:
+		return nil, fmt.Errorf("unknown gemini backend %q", cfg.Gemini.Backend)
+	}
+}
+
+// newGeminiBackend - Create a Gemini API client for the given configuration
+func newGeminiBackend(ctx context.Context, cfg *config.Config) (Backend, error) {
+	opts := []search.ClientOption{
+		search.WithModelName(cfg.Gemini.ModelName),
+	}
+	// The URL resolver stage needs the redirect links to report them as original_url;
+	// without it the library resolves one redirect level on its own.
+	if !cfg.Gemini.URLResolver.Enabled {
+		opts = append(opts, search.WithNoRedirection())
+	}
+
+	if tc := buildThinkingConfig(cfg); tc != nil {
+		opts = append(opts, search.WithDefaultThinkingConfig(tc))
+		budgetLog := "<nil>"
+		if tc.ThinkingBudget != nil {
+			budgetLog = fmt.Sprintf("%d", *tc.ThinkingBudget)
+		}
+		zap.S().Infow("ThinkingConfig enabled",
+			"thinking_level", tc.ThinkingLevel,
+			"thinking_budget", budgetLog)
+	}
+
+	apiKeys := cfg.APIKeys()
+	if len(apiKeys) == 0 {
+		return nil, ierrors.Wrap(search.ErrMissingAPIKey, "failed to create Gemini client")
+	}
+
+	keys := make([]*pooledKey, 0, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		client, err := search.NewClient(ctx, apiKey, opts...)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to create Gemini client")
+		}
+		keys = append(keys, &pooledKey{label: maskAPIKey(i, apiKey), backend: client})
+	}
+
+	if len(keys) == 1 {
+		return keys[0].backend, nil
+	}
+
+	zap.S().Infow("API key rotation enabled",
+		"keys", len(keys),
+		"strategy", cfg.Gemini.KeyRotation,
+		"bench_seconds", cfg.Gemini.KeyBenchSeconds)
+	return newKeyPool(keys, cfg), nil
+}
+
+func buildThinkingConfig(cfg *config.Config) *search.ThinkingConfig {
+	hasLevel := cfg.Gemini.ThinkingLevel != ""
+	hasBudget := cfg.Gemini.ThinkingBudget != nil
+
+	if !hasLevel && !hasBudget {
+		return nil
+	}
+
+	tc := &search.ThinkingConfig{}
+
+	if hasLevel {
+		tc.ThinkingLevel = search.ThinkingLevel(cfg.Gemini.ThinkingLevel)
+	}
+
+	if hasBudget {
+		b := *cfg.Gemini.ThinkingBudget
+		if b < 0 || b > int(^int32(0)>>1) {
+			zap.S().Warnw("thinking_budget out of int32 range, clamping", "original", b)
+			if b < 0 {
+				b = 0
+			} else {
+				b = int(^int32(0) >> 1)
+			}
+		}
+		budget := int32(b)
+		tc.ThinkingBudget = &budget
+	}
+
+	return tc
+}
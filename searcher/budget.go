@@ -0,0 +1,238 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"go.uber.org/zap"
+)
+
+// ErrBudgetExhausted - A request or token budget is used up for the current period
+var ErrBudgetExhausted = errors.New("budget exhausted")
+
+// principalKey - Context key of the principal searches are billed to
+type principalKey struct{}
+
+// WithPrincipal - Attach the name of the caller (e.g. the auth token name) that
+// per-token budgets are tracked for
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// principalFromContext - Principal attached with WithPrincipal, or "" when unknown
+func principalFromContext(ctx context.Context) string {
+	p, _ := ctx.Value(principalKey{}).(string)
+	return p
+}
+
+// budgetCounter - Requests and tokens used in the current UTC day and month
+type budgetCounter struct {
+	Day           string `json:"day"`
+	DayRequests   int    `json:"day_requests"`
+	DayTokens     int    `json:"day_tokens"`
+	Month         string `json:"month"`
+	MonthRequests int    `json:"month_requests"`
+	MonthTokens   int    `json:"month_tokens"`
+}
+
+// roll - Reset the counters of periods that ended before now
+func (c *budgetCounter) roll(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	month := now.UTC().Format("2006-01")
+	if c.Day != day {
+		c.Day, c.DayRequests, c.DayTokens = day, 0, 0
+	}
+	if c.Month != month {
+		c.Month, c.MonthRequests, c.MonthTokens = month, 0, 0
+	}
+}
+
+// exceeded - Describe the first limit the counter has reached and when it
+// resets, or "" when within limits
+func (c *budgetCounter) exceeded(limits config.BudgetLimits, now time.Time) (string, time.Time) {
+	y, m, d := now.UTC().Date()
+	nextDay := time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+
+	switch {
+	case limits.DailyRequests > 0 && c.DayRequests >= limits.DailyRequests:
+		return fmt.Sprintf("daily request budget of %d", limits.DailyRequests), nextDay
+	case limits.DailyTokens > 0 && c.DayTokens >= limits.DailyTokens:
+		return fmt.Sprintf("daily token budget of %d", limits.DailyTokens), nextDay
+	case limits.MonthlyRequests > 0 && c.MonthRequests >= limits.MonthlyRequests:
+		return fmt.Sprintf("monthly request budget of %d", limits.MonthlyRequests), nextMonth
+	case limits.MonthlyTokens > 0 && c.MonthTokens >= limits.MonthlyTokens:
+		return fmt.Sprintf("monthly token budget of %d", limits.MonthlyTokens), nextMonth
+	}
+	return "", time.Time{}
+}
+
+// budgetState - Persisted counters: Global for all searches, Principals per caller
+type budgetState struct {
+	Global     *budgetCounter            `json:"global"`
+	Principals map[string]*budgetCounter `json:"principals"`
+}
+
+// budget - Request and token budgets per UTC day and month, persisted to a
+// local state file so restarts do not reset them
+type budget struct {
+	global    config.BudgetLimits
+	perToken  config.BudgetLimits
+	statePath string
+
+	mu    sync.Mutex
+	state *budgetState
+}
+
+// newBudget - Create the budget from config, or nil when no limit is set.
+// A state file that exists but cannot be read is an error rather than a reset.
+func newBudget(cfg *config.Config) (*budget, error) {
+	if !cfg.Budget.Global.Enabled() && !cfg.Budget.PerToken.Enabled() {
+		return nil, nil
+	}
+	if cfg.Budget.StatePath == "" {
+		return nil, fmt.Errorf("budget.state_path is required when budgets are set")
+	}
+
+	b := &budget{
+		global:    cfg.Budget.Global,
+		perToken:  cfg.Budget.PerToken,
+		statePath: cfg.Budget.StatePath,
+		state:     &budgetState{Global: &budgetCounter{}, Principals: map[string]*budgetCounter{}},
+	}
+
+	data, err := os.ReadFile(b.statePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, ierrors.Wrap(err, "failed to read budget state")
+	default:
+		if err := json.Unmarshal(data, b.state); err != nil {
+			return nil, ierrors.Wrap(err, "failed to parse budget state "+b.statePath)
+		}
+		if b.state.Global == nil {
+			b.state.Global = &budgetCounter{}
+		}
+		if b.state.Principals == nil {
+			b.state.Principals = map[string]*budgetCounter{}
+		}
+	}
+
+	zap.S().Infow("budgets enabled",
+		"state_path", b.statePath,
+		"global", b.global,
+		"per_token", b.perToken)
+
+	return b, nil
+}
+
+// reserve - Count one request against the budgets of principal, or fail with
+// ErrBudgetExhausted without counting it when a limit is already reached
+func (b *budget) reserve(principal string) error {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counters := b.counters(principal, now)
+	for _, c := range counters {
+		if limit, resetsAt := c.exceeded(c.limits, now); limit != "" {
+			return fmt.Errorf("%w: %s %s used up, resets at %s",
+				ErrBudgetExhausted, c.scope, limit, resetsAt.Format(time.RFC3339))
+		}
+	}
+	for _, c := range counters {
+		c.DayRequests++
+		c.MonthRequests++
+	}
+	b.save()
+	return nil
+}
+
+// record - Add the tokens used by a completed request to the budgets of principal
+func (b *budget) record(principal string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.counters(principal, now) {
+		c.DayTokens += tokens
+		c.MonthTokens += tokens
+	}
+	b.save()
+}
+
+// release - Take back the request counted by reserve for a search that turned out
+// to need no Gemini call of its own
+func (b *budget) release(principal string) {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range b.counters(principal, now) {
+		c.DayRequests = max(0, c.DayRequests-1)
+		c.MonthRequests = max(0, c.MonthRequests-1)
+	}
+	b.save()
+}
+
+// scopedCounter - Counter together with the limits that apply to it
+type scopedCounter struct {
+	*budgetCounter
+	scope  string
+	limits config.BudgetLimits
+}
+
+// counters - Rolled counters that apply to a request of principal. Caller holds mu.
+func (b *budget) counters(principal string, now time.Time) []scopedCounter {
+	b.state.Global.roll(now)
+	counters := []scopedCounter{{b.state.Global, "global", b.global}}
+
+	if principal != "" && b.perToken.Enabled() {
+		c, ok := b.state.Principals[principal]
+		if !ok {
+			c = &budgetCounter{}
+			b.state.Principals[principal] = c
+		}
+		c.roll(now)
+		counters = append(counters, scopedCounter{c, fmt.Sprintf("token %q", principal), b.perToken})
+	}
+	return counters
+}
+
+// save - Write the state file atomically. Caller holds mu.
+func (b *budget) save() {
+	data, err := json.MarshalIndent(b.state, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.statePath), filepath.Base(b.statePath)+".*.tmp")
+	if err != nil {
+		zap.S().Errorw("failed to save budget state", "error", err)
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		zap.S().Errorw("failed to save budget state", "error", errors.Join(werr, cerr))
+		return
+	}
+	if err := os.Rename(tmp.Name(), b.statePath); err != nil {
+		os.Remove(tmp.Name())
+		zap.S().Errorw("failed to save budget state", "error", err)
+	}
+}
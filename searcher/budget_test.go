@@ -0,0 +1,44 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+func TestBudgetIgnoresCallsThatNeverReachGemini(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Budget.StatePath = filepath.Join(t.TempDir(), "budget.json")
+	cfg.Budget.Global.DailyRequests = 3
+	cfg.Gemini.RateLimit.RequestsPerMinute = 1
+	cfg.Gemini.RateLimit.Burst = 1
+
+	fake, err := newFakeBackend(fixturesDir)
+	if err != nil {
+		t.Fatalf("newFakeBackend: %v", err)
+	}
+	s := NewSearcherWithBackend(newRateLimitedBackend(&reachingBackend{next: fake}, cfg), cfg)
+	if s.budget, err = newBudget(cfg); err != nil {
+		t.Fatalf("newBudget: %v", err)
+	}
+
+	opts := SearchOptions{Timeout: 50 * time.Millisecond}
+	if _, err := s.Search(ctx, "What is Go?", opts); err != nil {
+		t.Fatalf("first search: %v", err)
+	}
+	// The limiter allows one request per minute, so these never reach Gemini
+	for range 3 {
+		if _, err := s.Search(ctx, "What is Go?", opts); !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("throttled search: err = %v, want ErrRateLimited", err)
+		}
+	}
+
+	if got := s.budget.state.Global.DayRequests; got != 1 {
+		t.Errorf("day requests = %d, want 1", got)
+	}
+}
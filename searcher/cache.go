@@ -0,0 +1,223 @@
+package searcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"github.com/cnosuke/mcp-gemini-grounded-search/internal/prompt"
+	"go.uber.org/zap"
+)
+
+// Cache - Store for search responses keyed by cacheKey
+type Cache interface {
+	// Get returns a copy of the stored response and the time it was stored
+	Get(key string) (*SearchResponse, time.Time, bool)
+	// Set stores a copy of the response
+	Set(key string, resp *SearchResponse)
+}
+
+// newCache - Create the cache selected by cache.type, or nil when caching is disabled
+func newCache(cfg *config.Config) (Cache, error) {
+	ttl := time.Duration(cfg.Cache.TTLSeconds) * time.Second
+
+	switch cfg.Cache.Type {
+	case "":
+		return nil, nil
+	case config.CacheMemory:
+		zap.S().Infow("response cache enabled",
+			"type", cfg.Cache.Type,
+			"ttl", ttl,
+			"max_entries", cfg.Cache.MaxEntries)
+		return newMemoryCache(cfg.Cache.MaxEntries, ttl), nil
+	case config.CacheDisk:
+		zap.S().Infow("response cache enabled",
+			"type", cfg.Cache.Type,
+			"ttl", ttl,
+			"max_entries", cfg.Cache.MaxEntries,
+			"dir", cfg.Cache.Dir)
+		return newDiskCache(cfg.Cache.Dir, cfg.Cache.MaxEntries, ttl)
+	default:
+		return nil, fmt.Errorf("unknown cache type %q", cfg.Cache.Type)
+	}
+}
+
+// cacheKey - Key for a search identified by its normalized question, prompt and generation settings
+func cacheKey(question, promptKey, model string, maxTokens int, thinkingLevel string) string {
+	raw := strings.Join([]string{
+		normalizeQuestion(question),
+		promptKey,
+		model,
+		fmt.Sprintf("%d", maxTokens),
+		thinkingLevel,
+	}, "\x00")
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// promptKey - Part of the cache key covering the template and the template
+// variables other than the question, which cacheKey normalizes separately.
+// The time of day is left out so answers can be reused for the rest of the day.
+func promptKey(template *prompt.Template, vars prompt.Vars) string {
+	text := ""
+	if template != nil {
+		text = template.Text()
+	}
+	return strings.Join([]string{text, vars.Date, vars.Timezone, vars.Locale, vars.Context}, "\x00")
+}
+
+// memoryCache - In-memory LRU cache
+type memoryCache struct {
+	lru *lruCache[[]byte]
+}
+
+func newMemoryCache(maxEntries int, ttl time.Duration) *memoryCache {
+	return &memoryCache{lru: newLRUCache[[]byte](maxEntries, ttl)}
+}
+
+// Get - Return the cached response for key
+func (c *memoryCache) Get(key string) (*SearchResponse, time.Time, bool) {
+	data, storedAt, ok := c.lru.Get(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	resp := &SearchResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return nil, time.Time{}, false
+	}
+	return resp, storedAt, true
+}
+
+// Set - Cache resp under key
+func (c *memoryCache) Set(key string, resp *SearchResponse) {
+	// Responses are stored serialized so callers never share mutable state.
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	c.lru.Set(key, data)
+}
+
+// diskCacheEntry - On-disk representation of a cached response
+type diskCacheEntry struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Response *SearchResponse `json:"response"`
+}
+
+// diskCache - Cache that keeps one JSON file per entry so it survives restarts
+type diskCache struct {
+	dir        string
+	maxEntries int
+	ttl        time.Duration
+	mu         sync.Mutex
+}
+
+func newDiskCache(dir string, maxEntries int, ttl time.Duration) (*diskCache, error) {
+	if dir == "" {
+		return nil, errors.New("cache dir is required for disk cache")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, ierrors.Wrap(err, "failed to create cache dir")
+	}
+	return &diskCache{dir: dir, maxEntries: maxEntries, ttl: ttl}, nil
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get - Return the cached response for key, removing it when expired
+func (c *diskCache) Get(key string) (*SearchResponse, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	entry := &diskCacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.Response == nil {
+		zap.S().Warnw("removing unreadable cache entry", "key", key, "error", err)
+		os.Remove(c.path(key))
+		return nil, time.Time{}, false
+	}
+	if c.ttl > 0 && time.Since(entry.StoredAt) > c.ttl {
+		os.Remove(c.path(key))
+		return nil, time.Time{}, false
+	}
+	// Touch the file so eviction order follows recent use.
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return entry.Response, entry.StoredAt, true
+}
+
+// Set - Write resp to disk under key and evict the oldest files beyond maxEntries
+func (c *diskCache) Set(key string, resp *SearchResponse) {
+	data, err := json.Marshal(&diskCacheEntry{StoredAt: time.Now().UTC(), Response: resp})
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		zap.S().Warnw("failed to write cache entry", "error", err)
+		return
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		zap.S().Warnw("failed to write cache entry", "error", errors.Join(werr, cerr))
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		zap.S().Warnw("failed to write cache entry", "error", err)
+		return
+	}
+
+	c.evict()
+}
+
+// evict - Remove the least recently used files beyond maxEntries. Caller holds mu.
+func (c *diskCache) evict() {
+	if c.maxEntries <= 0 {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil || len(paths) <= c.maxEntries {
+		return
+	}
+
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]file, 0, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		files = append(files, file{path: p, modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files[:max(0, len(files)-c.maxEntries)] {
+		os.Remove(f.path)
+	}
+}
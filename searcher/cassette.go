@@ -0,0 +1,204 @@
+package searcher
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"go.uber.org/zap"
+	"google.golang.org/genai"
+)
+
+// ErrCassetteMiss - Returned in replay mode when no recorded response matches a request
+var ErrCassetteMiss = errors.New("cassette miss: no recorded response for request")
+
+// cassettePromptKey - Context key of the prompt that identifies a request in cassettes
+type cassettePromptKey struct{}
+
+// withCassettePrompt - Attach the prompt cassettes identify the request by, which
+// leaves out parts that change between runs such as the current date
+func withCassettePrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, cassettePromptKey{}, prompt)
+}
+
+// cassetteRequest - The parts of a request that identify a recorded interaction
+type cassetteRequest struct {
+	// Prompt is the prompt with the current date and time left out
+	Prompt         string                 `json:"prompt"`
+	Model          string                 `json:"model"`
+	MaxTokens      int32                  `json:"max_tokens,omitempty"`
+	ThinkingConfig *search.ThinkingConfig `json:"thinking_config,omitempty"`
+}
+
+// cassetteEntry - One recorded interaction, stored as a single JSON line
+type cassetteEntry struct {
+	Key        string          `json:"key"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Request    cassetteRequest `json:"request"`
+	// SentPrompt is the prompt as sent when it differs from Request.Prompt
+	SentPrompt string                         `json:"sent_prompt,omitempty"`
+	Response   *search.Response               `json:"response"`
+	Raw        *genai.GenerateContentResponse `json:"raw,omitempty"`
+}
+
+func newCassetteRequest(ctx context.Context, params *search.GenerationParams) cassetteRequest {
+	prompt, ok := ctx.Value(cassettePromptKey{}).(string)
+	if !ok {
+		prompt = params.Prompt
+	}
+	req := cassetteRequest{
+		Prompt:         prompt,
+		Model:          params.ModelName,
+		ThinkingConfig: params.ThinkingConfig,
+	}
+	if params.MaxOutputTokens != nil {
+		req.MaxTokens = *params.MaxOutputTokens
+	}
+	return req
+}
+
+// key - Stable identifier of the request used to look up recordings
+func (r cassetteRequest) key() string {
+	bytes, _ := json.Marshal(r)
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// cassetteRecorder - Backend decorator that appends every successful interaction to a cassette file
+type cassetteRecorder struct {
+	next Backend
+	path string
+	mu   sync.Mutex
+}
+
+func newCassetteRecorder(next Backend, path string) (*cassetteRecorder, error) {
+	if path == "" {
+		return nil, errors.New("cassette path is required in record mode")
+	}
+	return &cassetteRecorder{next: next, path: path}, nil
+}
+
+// GenerateGroundedContentWithParams - Call the wrapped backend and record the result
+func (r *cassetteRecorder) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	resp, err := r.next.GenerateGroundedContentWithParams(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	req := newCassetteRequest(ctx, params)
+	entry := &cassetteEntry{
+		Key:        req.key(),
+		RecordedAt: time.Now().UTC(),
+		Request:    req,
+		Response:   resp,
+		Raw:        resp.RawResponse,
+	}
+	if params.Prompt != req.Prompt {
+		entry.SentPrompt = params.Prompt
+	}
+	if err := r.append(entry); err != nil {
+		// Recording is best effort; the caller still gets its answer.
+		zap.S().Errorw("failed to record cassette entry",
+			"path", r.path,
+			"error", err)
+	}
+
+	return resp, nil
+}
+
+func (r *cassetteRecorder) append(entry *cassetteEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return ierrors.Wrap(err, "failed to marshal cassette entry")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return ierrors.Wrap(err, "failed to open cassette file")
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return ierrors.Wrap(err, "failed to write cassette entry")
+	}
+	return nil
+}
+
+// cassettePlayer - Backend that serves recorded interactions and never calls the network
+type cassettePlayer struct {
+	entries map[string]*cassetteEntry
+}
+
+func newCassettePlayer(path string) (*cassettePlayer, error) {
+	if path == "" {
+		return nil, errors.New("cassette path is required in replay mode")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ierrors.Wrap(err, "failed to open cassette file")
+	}
+	defer f.Close()
+
+	p := &cassettePlayer{entries: map[string]*cassetteEntry{}}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &cassetteEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, ierrors.Wrap(err, fmt.Sprintf("failed to parse cassette line %d", lineNo))
+		}
+		if entry.Response == nil {
+			return nil, fmt.Errorf("cassette line %d has no response", lineNo)
+		}
+		// Later recordings of the same request win.
+		p.entries[entry.Request.key()] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ierrors.Wrap(err, "failed to read cassette file")
+	}
+
+	zap.S().Infow("cassette loaded",
+		"path", path,
+		"entries", len(p.entries))
+
+	return p, nil
+}
+
+// GenerateGroundedContentWithParams - Return the recorded response or ErrCassetteMiss
+func (p *cassettePlayer) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	req := newCassetteRequest(ctx, params)
+	entry, ok := p.entries[req.key()]
+	if !ok {
+		zap.S().Errorw("cassette miss",
+			"model", req.Model,
+			"max_tokens", req.MaxTokens,
+			"prompt", req.Prompt)
+		return nil, fmt.Errorf("%w (model: %s, max_tokens: %d)", ErrCassetteMiss, req.Model, req.MaxTokens)
+	}
+
+	markReached(ctx)
+	resp := *entry.Response
+	if entry.Raw != nil {
+		resp.RawResponse = entry.Raw
+		resp.Candidates = entry.Raw.Candidates
+	}
+	return &resp, nil
+}
@@ -0,0 +1,126 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Gemini.ModelName = "gemini-test"
+	cfg.Gemini.QueryTemplate = "Answer briefly. %s"
+	cfg.Gemini.DefaultTemplate = config.DefaultTemplateName
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	fake, err := newFakeBackend(fixturesDir)
+	if err != nil {
+		t.Fatalf("newFakeBackend: %v", err)
+	}
+	recorder, err := newCassetteRecorder(fake, path)
+	if err != nil {
+		t.Fatalf("newCassetteRecorder: %v", err)
+	}
+
+	questions := []string{"What is the capital of France?", "What is Go?", "Is this question unknown?"}
+	live := NewSearcherWithBackend(recorder, cfg)
+	recorded := make([]*SearchResponse, 0, len(questions))
+	for _, q := range questions {
+		r, err := live.Search(ctx, q, SearchOptions{})
+		if err != nil {
+			t.Fatalf("Search(%q) while recording: %v", q, err)
+		}
+		recorded = append(recorded, r)
+	}
+
+	player, err := newCassettePlayer(path)
+	if err != nil {
+		t.Fatalf("newCassettePlayer: %v", err)
+	}
+	if len(player.entries) != len(questions) {
+		t.Fatalf("cassette has %d entries, want %d", len(player.entries), len(questions))
+	}
+
+	replay := NewSearcherWithBackend(player, cfg)
+	for i, q := range questions {
+		r, err := replay.Search(ctx, q, SearchOptions{})
+		if err != nil {
+			t.Fatalf("Search(%q) while replaying: %v", q, err)
+		}
+		want := recorded[i]
+		if r.Text != want.Text {
+			t.Errorf("Search(%q) text = %q, want %q", q, r.Text, want.Text)
+		}
+		if !reflect.DeepEqual(r.Groundings, want.Groundings) {
+			t.Errorf("Search(%q) groundings differ after replay", q)
+		}
+		if !reflect.DeepEqual(r.Supports, want.Supports) {
+			t.Errorf("Search(%q) supports differ after replay", q)
+		}
+		if !reflect.DeepEqual(r.SearchQueries, want.SearchQueries) {
+			t.Errorf("Search(%q) search queries = %v, want %v", q, r.SearchQueries, want.SearchQueries)
+		}
+		if r.Usage == nil || want.Usage == nil || r.Usage.TotalTokens != want.Usage.TotalTokens {
+			t.Errorf("Search(%q) usage = %+v, want %+v", q, r.Usage, want.Usage)
+		}
+	}
+
+	if _, err := replay.Search(ctx, "Never recorded", SearchOptions{}); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("Search of unrecorded question: err = %v, want ErrCassetteMiss", err)
+	}
+}
+
+func TestCassetteReplayOnAnotherDay(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	cfg.Gemini.ModelName = "gemini-test"
+	cfg.Gemini.QueryTemplate = "As of {{.Date}} {{.Time}}: {{.Question}}"
+	cfg.Gemini.DefaultTemplate = config.DefaultTemplateName
+	cfg.Gemini.DatePreamble = true
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	fake, err := newFakeBackend(fixturesDir)
+	if err != nil {
+		t.Fatalf("newFakeBackend: %v", err)
+	}
+	recorder, err := newCassetteRecorder(fake, path)
+	if err != nil {
+		t.Fatalf("newCassetteRecorder: %v", err)
+	}
+	live := NewSearcherWithBackend(recorder, cfg)
+	live.now = func() time.Time { return time.Date(2025, 1, 1, 9, 30, 0, 0, time.UTC) }
+	recorded, err := live.Search(ctx, "What is Go?", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search while recording: %v", err)
+	}
+
+	player, err := newCassettePlayer(path)
+	if err != nil {
+		t.Fatalf("newCassettePlayer: %v", err)
+	}
+	if len(player.entries) != 1 {
+		t.Fatalf("cassette has %d entries, want 1", len(player.entries))
+	}
+	for _, entry := range player.entries {
+		if !strings.Contains(entry.SentPrompt, "2025-01-01 09:30") {
+			t.Errorf("sent prompt %q does not hold the recording time", entry.SentPrompt)
+		}
+	}
+
+	replay := NewSearcherWithBackend(player, cfg)
+	replay.now = func() time.Time { return time.Date(2025, 6, 15, 18, 5, 0, 0, time.UTC) }
+	r, err := replay.Search(ctx, "What is Go?", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search while replaying on another day: %v", err)
+	}
+	if r.Text != recorded.Text {
+		t.Errorf("replayed text = %q, want %q", r.Text, recorded.Text)
+	}
+}
@@ -0,0 +1,172 @@
+package searcher
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+)
+
+// Support - Segment of the answer text and the groundings backing it.
+// Offsets are byte offsets into SearchResponse.Text, end exclusive.
+type Support struct {
+	StartIndex       int    `json:"start_index"`
+	EndIndex         int    `json:"end_index"`
+	Text             string `json:"text"`
+	GroundingIndices []int  `json:"grounding_indices"`
+}
+
+// extractSupports - Rebuild grounding supports from the segments the library
+// attaches to each attribution. Attributions map 1:1 to SearchResponse.Groundings,
+// so an attribution's position is the grounding index.
+func extractSupports(result *search.Response) []*Support {
+	partOffsets := textPartOffsets(result)
+
+	type segmentKey struct{ part, start, end int }
+	byKey := map[segmentKey]*Support{}
+	for i, attr := range result.GroundingAttributions {
+		for _, seg := range attr.Segments {
+			offset := 0
+			if seg.PartIndex < len(partOffsets) {
+				offset = partOffsets[seg.PartIndex]
+			}
+			key := segmentKey{seg.PartIndex, seg.StartIndex, seg.EndIndex}
+			sup, ok := byKey[key]
+			if !ok {
+				sup = &Support{
+					StartIndex: offset + seg.StartIndex,
+					EndIndex:   offset + seg.EndIndex,
+					Text:       seg.Text,
+				}
+				byKey[key] = sup
+			}
+			if !slices.Contains(sup.GroundingIndices, i) {
+				sup.GroundingIndices = append(sup.GroundingIndices, i)
+			}
+		}
+	}
+
+	supports := make([]*Support, 0, len(byKey))
+	textLen := len(result.GeneratedText)
+	for _, sup := range byKey {
+		if sup.StartIndex < 0 || sup.EndIndex > textLen || sup.StartIndex > sup.EndIndex {
+			continue
+		}
+		sup.StartIndex, sup.EndIndex = snapToRunes(result.GeneratedText, sup.StartIndex, sup.EndIndex)
+		sort.Ints(sup.GroundingIndices)
+		supports = append(supports, sup)
+	}
+	sort.Slice(supports, func(i, j int) bool {
+		if supports[i].StartIndex != supports[j].StartIndex {
+			return supports[i].StartIndex < supports[j].StartIndex
+		}
+		return supports[i].EndIndex < supports[j].EndIndex
+	})
+	return supports
+}
+
+// snapToRunes - Widen [start, end) to whole runes of text, so an offset inside a
+// multi-byte character cannot split it when citations are inserted
+func snapToRunes(text string, start, end int) (int, int) {
+	for start > 0 && start < len(text) && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// textPartOffsets - Byte offset of each content part within the generated text,
+// which the library builds by concatenating the text of every part
+func textPartOffsets(result *search.Response) []int {
+	if len(result.Candidates) == 0 || result.Candidates[0] == nil || result.Candidates[0].Content == nil {
+		return nil
+	}
+	parts := result.Candidates[0].Content.Parts
+	offsets := make([]int, len(parts))
+	total := 0
+	for i, part := range parts {
+		offsets[i] = total
+		if part != nil {
+			total += len(part.Text)
+		}
+	}
+	return offsets
+}
+
+// insertCitations - Insert [n] markers after each supported segment, where n is
+// the 1-based grounding index, and append a numbered reference list.
+// Support offsets are shifted to stay valid for the rewritten text.
+func insertCitations(r *SearchResponse) {
+	if len(r.Supports) == 0 || len(r.Groundings) == 0 {
+		return
+	}
+
+	// Markers to insert, keyed by byte position
+	markers := map[int][]int{}
+	for _, sup := range r.Supports {
+		for _, idx := range sup.GroundingIndices {
+			if idx >= 0 && idx < len(r.Groundings) && !slices.Contains(markers[sup.EndIndex], idx) {
+				markers[sup.EndIndex] = append(markers[sup.EndIndex], idx)
+			}
+		}
+	}
+	positions := make([]int, 0, len(markers))
+	for pos := range markers {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+
+	var b strings.Builder
+	inserted := make([]int, len(positions)) // bytes inserted at positions[i]
+	prev := 0
+	for i, pos := range positions {
+		b.WriteString(r.Text[prev:pos])
+		indices := markers[pos]
+		sort.Ints(indices)
+		before := b.Len()
+		for _, idx := range indices {
+			fmt.Fprintf(&b, "[%d]", idx+1)
+		}
+		inserted[i] = b.Len() - before
+		prev = pos
+	}
+	b.WriteString(r.Text[prev:])
+
+	// shift - Bytes inserted strictly before pos, or at pos when inclusive
+	shift := func(pos int, inclusive bool) int {
+		n := 0
+		for i, p := range positions {
+			if p < pos || (inclusive && p == pos) {
+				n += inserted[i]
+			}
+		}
+		return n
+	}
+	for _, sup := range r.Supports {
+		sup.StartIndex += shift(sup.StartIndex, true)
+		sup.EndIndex += shift(sup.EndIndex, false)
+	}
+
+	b.WriteString("\n\nReferences:\n")
+	for i, g := range r.Groundings {
+		fmt.Fprintf(&b, "[%d] %s - %s\n", i+1, groundingTitle(g), g.URL)
+	}
+
+	r.answer = r.Text
+	r.Text = strings.TrimRight(b.String(), "\n")
+	r.citationsInserted = true
+}
+
+// Answer - Answer text without the citation markers and reference list added by
+// the citations option
+func (r *SearchResponse) Answer() string {
+	if r.citationsInserted {
+		return r.answer
+	}
+	return r.Text
+}
@@ -0,0 +1,55 @@
+package searcher
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+)
+
+func TestInsertCitationsKeepsRunesWhole(t *testing.T) {
+	text := "Go is fast — and simple."
+	dash := len("Go is fast ")
+	// Offsets one byte into the three-byte dash, as a sloppy backend might report them
+	result := &search.Response{
+		GeneratedText: text,
+		GroundingAttributions: []search.GroundingAttribution{
+			{Title: "A", URL: "https://a.example/", Segments: []search.GroundingAttributionSegment{{StartIndex: 0, EndIndex: dash + 1}}},
+			{Title: "B", URL: "https://b.example/", Segments: []search.GroundingAttributionSegment{{StartIndex: dash + 2, EndIndex: len(text)}}},
+		},
+	}
+
+	r := &SearchResponse{
+		Text:       text,
+		Groundings: []*Grounding{{Title: "A", URL: "https://a.example/"}, {Title: "B", URL: "https://b.example/"}},
+		Supports:   extractSupports(result),
+	}
+	for _, sup := range r.Supports {
+		if !utf8.ValidString(text[sup.StartIndex:sup.EndIndex]) {
+			t.Errorf("support [%d, %d) splits a rune", sup.StartIndex, sup.EndIndex)
+		}
+	}
+
+	insertCitations(r)
+	if !utf8.ValidString(r.Text) {
+		t.Fatalf("text with citations is not valid UTF-8: %q", r.Text)
+	}
+	want := "Go is fast —[1] and simple.[2]\n\nReferences:\n[1] A - https://a.example/\n[2] B - https://b.example/"
+	if r.Text != want {
+		t.Errorf("text = %q, want %q", r.Text, want)
+	}
+}
+
+func TestExtractSupportsAtEndOfText(t *testing.T) {
+	// An empty segment at the very end of the answer must not index past the text
+	result := &search.Response{
+		GeneratedText: "abc",
+		GroundingAttributions: []search.GroundingAttribution{
+			{Title: "A", URL: "https://a.example/", Segments: []search.GroundingAttributionSegment{{StartIndex: 3, EndIndex: 3}}},
+		},
+	}
+	supports := extractSupports(result)
+	if len(supports) != 1 || supports[0].StartIndex != 3 || supports[0].EndIndex != 3 {
+		t.Errorf("supports = %+v", supports)
+	}
+}
@@ -0,0 +1,203 @@
+package searcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"go.uber.org/zap"
+)
+
+// coalescedCall - One upstream request shared by every identical concurrent caller
+type coalescedCall struct {
+	done    chan struct{}
+	resp    *search.Response
+	err     error
+	waiters []*callInfo
+	// owner is the waiter charged for the call: the caller that started it, or
+	// another waiter once that caller has gone away
+	owner *callInfo
+	ctx   *sharedContext
+	// reached is set when the call reached the provider
+	reached bool
+}
+
+// sharedContext - Context of a coalesced call. It keeps the values of the caller
+// that started the call but not its cancellation; its deadline is the latest
+// deadline among the waiters, or none once a waiter without a deadline joins.
+type sharedContext struct {
+	context.Context
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newSharedContext(ctx context.Context) *sharedContext {
+	base, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	c := &sharedContext{Context: base, cancel: cancel}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.deadline = deadline
+		c.timer = time.AfterFunc(time.Until(deadline), func() {
+			cancel(context.DeadlineExceeded)
+		})
+	}
+	return c
+}
+
+// join - Extend the deadline to cover a waiter with ctx
+func (c *sharedContext) join(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer == nil {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		c.timer.Stop()
+		c.timer = nil
+		c.deadline = time.Time{}
+		return
+	}
+	if deadline.After(c.deadline) && c.timer.Stop() {
+		c.deadline = deadline
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+// Deadline - Latest deadline among the waiters
+func (c *sharedContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, !c.deadline.IsZero()
+}
+
+// Err - context.DeadlineExceeded once the deadline has passed, like a context with a timeout
+func (c *sharedContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// stop - Cancel the call and release its timer
+func (c *sharedContext) stop() {
+	cause := context.Canceled
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		if !time.Now().Before(c.deadline) {
+			cause = context.DeadlineExceeded
+		}
+	}
+	c.mu.Unlock()
+	c.cancel(cause)
+}
+
+// coalescingBackend - Backend decorator that lets concurrent identical requests
+// share a single upstream call and its response
+type coalescingBackend struct {
+	next Backend
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+func newCoalescingBackend(next Backend) *coalescingBackend {
+	return &coalescingBackend{
+		next:  next,
+		calls: map[string]*coalescedCall{},
+	}
+}
+
+// requestKey - Identifier of a request covering the prompt and all generation params
+func requestKey(params *search.GenerationParams) string {
+	bytes, _ := json.Marshal(params)
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateGroundedContentWithParams - Join an in-flight identical request or start a new one
+func (b *coalescingBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	key := requestKey(params)
+	me := callInfoFrom(ctx)
+	if me == nil {
+		me = &callInfo{}
+	}
+
+	b.mu.Lock()
+	c, ok := b.calls[key]
+	if ok {
+		c.waiters = append(c.waiters, me)
+		c.ctx.join(ctx)
+		b.mu.Unlock()
+		zap.S().Debugw("coalescing identical in-flight search", "key", key)
+	} else {
+		// The upstream call must outlive the caller that started it, so it is
+		// detached from that caller's cancellation. It is cancelled once every
+		// waiter has gone away or the latest of their deadlines has passed.
+		c = &coalescedCall{done: make(chan struct{}), waiters: []*callInfo{me}, owner: me, ctx: newSharedContext(ctx)}
+		b.calls[key] = c
+		b.mu.Unlock()
+
+		go b.run(key, c, params)
+	}
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		b.mu.Lock()
+		select {
+		case <-c.done:
+			// The call finished meanwhile; take its result so it does not go unpaid
+			b.mu.Unlock()
+		default:
+			c.waiters = slices.DeleteFunc(c.waiters, func(w *callInfo) bool { return w == me })
+			if len(c.waiters) == 0 {
+				c.ctx.stop()
+				if b.calls[key] == c {
+					delete(b.calls, key)
+				}
+			} else if c.owner == me {
+				// Charge the call to a caller that will still receive its result
+				c.owner = c.waiters[0]
+			}
+			b.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+
+	b.mu.Lock()
+	owner := c.owner == me
+	b.mu.Unlock()
+	me.joined = !owner
+	if owner {
+		me.reached = me.reached || c.reached
+	}
+	return c.resp, c.err
+}
+
+func (b *coalescingBackend) run(key string, c *coalescedCall, params *search.GenerationParams) {
+	defer c.ctx.stop()
+
+	// The shared call reports to its own callInfo; waiters read it once it is done
+	ctx, upstream := withCallInfo(c.ctx)
+	c.resp, c.err = b.next.GenerateGroundedContentWithParams(ctx, params)
+	c.reached = upstream.reached
+
+	b.mu.Lock()
+	if b.calls[key] == c {
+		delete(b.calls, key)
+	}
+	b.mu.Unlock()
+	close(c.done)
+}
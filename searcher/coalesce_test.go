@@ -0,0 +1,146 @@
+package searcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+)
+
+// deadlineBackend - Backend that reports the deadline it sees once released,
+// or the error of its context when that ends first
+type deadlineBackend struct {
+	started  chan struct{}
+	release  chan struct{}
+	deadline chan time.Time
+	err      chan error
+}
+
+func newDeadlineBackend() *deadlineBackend {
+	return &deadlineBackend{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		deadline: make(chan time.Time, 1),
+		err:      make(chan error, 1),
+	}
+}
+
+func (b *deadlineBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	close(b.started)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		b.err <- ctx.Err()
+		return nil, ctx.Err()
+	}
+	deadline, _ := ctx.Deadline()
+	b.deadline <- deadline
+	return &search.Response{GeneratedText: "ok"}, nil
+}
+
+func TestCoalescedCallUsesLatestDeadline(t *testing.T) {
+	next := newDeadlineBackend()
+	b := newCoalescingBackend(next)
+	params := &search.GenerationParams{Prompt: "q"}
+
+	first, cancelFirst := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelFirst()
+	second, cancelSecond := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelSecond()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := b.GenerateGroundedContentWithParams(first, params)
+		errs <- err
+	}()
+	<-next.started
+	go func() {
+		_, err := b.GenerateGroundedContentWithParams(second, params)
+		errs <- err
+	}()
+	// Wait for the second caller to join before letting the call finish
+	for {
+		b.mu.Lock()
+		waiters := len(b.calls[requestKey(params)].waiters)
+		b.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(next.release)
+
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("coalesced call failed: %v", err)
+		}
+	}
+	want, _ := second.Deadline()
+	if got := <-next.deadline; !got.Equal(want) {
+		t.Errorf("shared call deadline = %v, want the latest waiter deadline %v", got, want)
+	}
+}
+
+func TestCoalescedCallDeadlineExpires(t *testing.T) {
+	next := newDeadlineBackend()
+	b := newCoalescingBackend(next)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.GenerateGroundedContentWithParams(ctx, &search.GenerationParams{Prompt: "q"}); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	// The shared call ends with the deadline rather than running on detached
+	if err := <-next.err; err != context.DeadlineExceeded {
+		t.Errorf("shared call err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestCoalescedCallChargedToRemainingWaiter(t *testing.T) {
+	next := newDeadlineBackend()
+	b := newCoalescingBackend(&reachingBackend{next: next})
+	params := &search.GenerationParams{Prompt: "q"}
+
+	starterCtx, cancelStarter := context.WithCancel(context.Background())
+	starterCtx, starter := withCallInfo(starterCtx)
+	joinerCtx, joiner := withCallInfo(context.Background())
+
+	starterErr := make(chan error, 1)
+	go func() {
+		_, err := b.GenerateGroundedContentWithParams(starterCtx, params)
+		starterErr <- err
+	}()
+	<-next.started
+	joinerErr := make(chan error, 1)
+	go func() {
+		_, err := b.GenerateGroundedContentWithParams(joinerCtx, params)
+		joinerErr <- err
+	}()
+	for {
+		b.mu.Lock()
+		waiters := len(b.calls[requestKey(params)].waiters)
+		b.mu.Unlock()
+		if waiters == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The starter gives up before the call completes
+	cancelStarter()
+	if err := <-starterErr; err != context.Canceled {
+		t.Fatalf("starter err = %v, want context.Canceled", err)
+	}
+	close(next.release)
+	if err := <-joinerErr; err != nil {
+		t.Fatalf("joiner err = %v", err)
+	}
+
+	if starter.reached || starter.joined {
+		t.Errorf("starter = %+v, want neither joined nor reached", *starter)
+	}
+	if joiner.joined || !joiner.reached {
+		t.Errorf("joiner = %+v, want to be charged for the call", *joiner)
+	}
+}
@@ -0,0 +1,43 @@
+package searcher
+
+import (
+	"strings"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+// credibilityTable - Classifies grounding domains into categories and trust tiers
+type credibilityTable struct {
+	table *config.Credibility
+}
+
+// annotate - Set Category and TrustTier of every grounding whose domain is classified
+func (c *credibilityTable) annotate(groundings []*Grounding) {
+	for _, g := range groundings {
+		category := c.classify(g.Domain)
+		if category == "" {
+			category = c.classify(hostOf(g.URL))
+		}
+		if category == "" {
+			continue
+		}
+		g.Category = category
+		g.TrustTier = c.table.Categories[category].Tier
+	}
+}
+
+// classify - Category of the longest domain pattern matching host, or "" when none does
+func (c *credibilityTable) classify(host string) string {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	if host == "" {
+		return ""
+	}
+	var best, category string
+	for pattern, cat := range c.table.Domains {
+		p := strings.TrimPrefix(strings.ToLower(pattern), "*.")
+		if (host == p || strings.HasSuffix(host, "."+p)) && len(p) > len(best) {
+			best, category = p, cat
+		}
+	}
+	return category
+}
@@ -0,0 +1,106 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+)
+
+// httpStatusOf - HTTP status code of a Gemini API error, or 0 when unknown
+func httpStatusOf(err error) int {
+	// The library wraps the SDK error with codes.Unknown, so prefer the
+	// HTTP status carried by the SDK error when it is available. Without one,
+	// codes.Unknown also covers DNS, TLS and malformed-request failures, so it
+	// maps to no status and timeouts are left to the net.Error check.
+	var gErr genai.APIError
+	if errors.As(err, &gErr) && gErr.Code != 0 {
+		return gErr.Code
+	}
+
+	apiErr, ok := search.GetAPIError(err)
+	if !ok {
+		return 0
+	}
+	switch apiErr.StatusCode {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return 0
+}
+
+// isRetryableError - Whether err is a transient failure worth retrying:
+// rate limiting, server errors and network timeouts. Blocked content is never retried.
+func isRetryableError(err error) bool {
+	if err == nil || search.IsContentBlockedError(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	switch httpStatusOf(err) {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isFallbackError - Whether err means the model itself cannot serve the request
+// right now (quota exhausted, model not found or overloaded), so another model may succeed.
+func isFallbackError(err error) bool {
+	if err == nil || search.IsContentBlockedError(err) {
+		return false
+	}
+	switch httpStatusOf(err) {
+	case http.StatusTooManyRequests, http.StatusNotFound, http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// retryAfterOf - Server-suggested delay before retrying, taken from the
+// google.rpc.RetryInfo detail of the API error. Returns 0 when absent.
+func retryAfterOf(err error) time.Duration {
+	var gErr genai.APIError
+	if !errors.As(err, &gErr) {
+		return 0
+	}
+	for _, detail := range gErr.Details {
+		t, _ := detail["@type"].(string)
+		if !strings.HasSuffix(t, "google.rpc.RetryInfo") {
+			continue
+		}
+		delay, _ := detail["retryDelay"].(string)
+		if d, err := time.ParseDuration(delay); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+package searcher
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"go.uber.org/zap"
+	"google.golang.org/genai"
+)
+
+// fakeNoMatchText - Answer returned when no fixture matches the prompt
+const fakeNoMatchText = "This is a canned answer from the fake backend. No fixture matched the question."
+
+// fakeFixture - Canned answer loaded from a fixture file
+type fakeFixture struct {
+	Question   string           `json:"question"`
+	Text       string           `json:"text"`
+	Groundings []*fakeGrounding `json:"groundings"`
+	// SearchQueries are reported as the web search queries the model ran
+	SearchQueries []string `json:"search_queries,omitempty"`
+
+	key string
+}
+
+// fakeGrounding - Grounding of a fixture with the answer segments it supports
+type fakeGrounding struct {
+	Grounding
+	Segments []search.GroundingAttributionSegment `json:"segments,omitempty"`
+}
+
+// questionKey - Context key of the question a prompt was built from
+type questionKey struct{}
+
+// withQuestion - Attach the caller's question, without query template or
+// conversation history, to ctx so the fake backend can match fixtures on it
+func withQuestion(ctx context.Context, question string) context.Context {
+	return context.WithValue(ctx, questionKey{}, question)
+}
+
+// fakeBackend - Deterministic offline backend that serves canned answers
+type fakeBackend struct {
+	fixtures []*fakeFixture
+}
+
+// newFakeBackend - Create a fake backend from the JSON fixtures in dir.
+// An empty dir yields a backend that answers every question with the same placeholder.
+func newFakeBackend(dir string) (*fakeBackend, error) {
+	b := &fakeBackend{}
+	if dir == "" {
+		return b, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, ierrors.Wrap(err, "failed to list fixture files")
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to read fixture "+path)
+		}
+		f := &fakeFixture{}
+		if err := json.Unmarshal(data, f); err != nil {
+			return nil, ierrors.Wrap(err, "failed to parse fixture "+path)
+		}
+		f.key = normalizeQuestion(f.Question)
+		if f.key == "" {
+			zap.S().Warnw("skipping fixture without question", "path", path)
+			continue
+		}
+		b.fixtures = append(b.fixtures, f)
+	}
+
+	// Longest questions first so the most specific fixture wins when several
+	// fixture questions are contained in the same question.
+	sort.SliceStable(b.fixtures, func(i, j int) bool {
+		return len(b.fixtures[i].key) > len(b.fixtures[j].key)
+	})
+
+	zap.S().Infow("fake backend loaded fixtures",
+		"dir", dir,
+		"count", len(b.fixtures))
+
+	return b, nil
+}
+
+// GenerateGroundedContentWithParams - Return the fixture whose question appears in
+// the caller's question, or in the whole prompt when the question is not known.
+// Template text and conversation history are not matched so they cannot select a fixture.
+func (b *fakeBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	if params == nil || params.Prompt == "" {
+		return nil, ierrors.Wrap(search.ErrInvalidParameter, "prompt cannot be empty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	question, ok := ctx.Value(questionKey{}).(string)
+	if !ok {
+		question = params.Prompt
+	}
+	question = normalizeQuestion(question)
+	for _, f := range b.fixtures {
+		if strings.Contains(question, f.key) {
+			return withFakeUsage(f.toResponse(), params.Prompt), nil
+		}
+	}
+
+	zap.S().Debugw("no fixture matched prompt", "prompt", params.Prompt)
+	return withFakeUsage(&search.Response{GeneratedText: fakeNoMatchText}, params.Prompt), nil
+}
+
+// withFakeUsage - Attach approximate token counts (about four bytes per token)
+// so usage reporting can be exercised offline
+func withFakeUsage(resp *search.Response, prompt string) *search.Response {
+	promptTokens := int32(len(prompt)/4 + 1)
+	candidatesTokens := int32(len(resp.GeneratedText)/4 + 1)
+	resp.RawResponse = &genai.GenerateContentResponse{
+		Candidates: resp.Candidates,
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount:     promptTokens,
+			CandidatesTokenCount: candidatesTokens,
+			TotalTokenCount:      promptTokens + candidatesTokens,
+		},
+	}
+	return resp
+}
+
+func (f *fakeFixture) toResponse() *search.Response {
+	resp := &search.Response{
+		GeneratedText:         f.Text,
+		GroundingAttributions: make([]search.GroundingAttribution, 0, len(f.Groundings)),
+	}
+	for _, g := range f.Groundings {
+		if g == nil {
+			continue
+		}
+		resp.GroundingAttributions = append(resp.GroundingAttributions, search.GroundingAttribution{
+			Title:    g.Title,
+			Domain:   g.Domain,
+			URL:      g.URL,
+			Segments: g.Segments,
+		})
+	}
+	if len(f.SearchQueries) > 0 {
+		resp.Candidates = []*genai.Candidate{{
+			GroundingMetadata: &genai.GroundingMetadata{WebSearchQueries: f.SearchQueries},
+		}}
+	}
+	return resp
+}
@@ -0,0 +1,52 @@
+package searcher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+const fixturesDir = "../testdata/fixtures"
+
+func TestFakeBackendFixtures(t *testing.T) {
+	ctx := context.Background()
+	fake, err := newFakeBackend(fixturesDir)
+	if err != nil {
+		t.Fatalf("newFakeBackend: %v", err)
+	}
+	if len(fake.fixtures) == 0 {
+		t.Fatalf("no fixtures loaded from %s", fixturesDir)
+	}
+
+	cfg := &config.Config{}
+	// The template mentions a fixture question, which must not select that fixture
+	cfg.Gemini.QueryTemplate = "Unlike 'What is Go?', answer this: %s"
+	cfg.Gemini.DefaultTemplate = config.DefaultTemplateName
+	s := NewSearcherWithBackend(fake, cfg)
+
+	r, err := s.Search(ctx, "  what is the CAPITAL of France? ", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if r.Text != "The capital of France is Paris. Paris has been the seat of government for most of French history." {
+		t.Errorf("text = %q", r.Text)
+	}
+	// The duplicate Britannica link is merged and the most supporting source ranks first
+	if len(r.Groundings) != 2 || r.Groundings[0].Domain != "britannica.com" || r.Groundings[0].SupportCount != 2 {
+		t.Errorf("groundings = %+v", r.Groundings)
+	}
+	if len(r.SearchQueries) != 1 || r.SearchQueries[0] != "capital of France" {
+		t.Errorf("search queries = %v", r.SearchQueries)
+	}
+
+	// A follow-up whose history holds a fixture question gets no fixture of its own
+	history := []Turn{{Question: "What is the capital of France?", Answer: r.Text, Groundings: r.Groundings}}
+	r, err = s.Search(ctx, "and why", SearchOptions{History: history})
+	if err != nil {
+		t.Fatalf("Search follow-up: %v", err)
+	}
+	if r.Text != fakeNoMatchText {
+		t.Errorf("follow-up text = %q, want the placeholder", r.Text)
+	}
+}
@@ -0,0 +1,92 @@
+package searcher
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// SourceFilter - Domain patterns deciding which groundings are kept. A pattern
+// matches the domain itself and all of its subdomains; a leading "*." is optional.
+type SourceFilter struct {
+	// Allow keeps only sources matching one of the patterns when non-empty
+	Allow []string
+	// Deny removes sources matching any of the patterns
+	Deny []string
+	// RedirectHosts are hosts of unresolved redirect links, which say nothing
+	// about the source and are matched by the grounding's domain only
+	RedirectHosts []string
+}
+
+// applyFilter - Remove groundings rejected by the server filter or the per-call
+// include and exclude patterns, and record what was removed in the response.
+// A source must pass the allowlist and, when include is set, match it too.
+func (f SourceFilter) applyFilter(r *SearchResponse, include, exclude []string) {
+	if len(f.Allow) == 0 && len(f.Deny) == 0 && len(include) == 0 && len(exclude) == 0 {
+		return
+	}
+
+	removed := keepGroundings(r, func(g *Grounding) bool {
+		hosts := f.groundingHosts(g)
+		switch {
+		case matchesAny(hosts, f.Deny), matchesAny(hosts, exclude):
+			return false
+		case len(f.Allow) > 0 && !matchesAny(hosts, f.Allow):
+			return false
+		case len(include) > 0 && !matchesAny(hosts, include):
+			return false
+		}
+		return true
+	})
+
+	for _, g := range removed {
+		domain := g.Domain
+		if domain == "" {
+			domain = hostOf(g.URL)
+		}
+		if !slices.Contains(r.FilteredSources, domain) {
+			r.FilteredSources = append(r.FilteredSources, domain)
+		}
+		if g.SupportCount > 0 {
+			r.ReliedOnFilteredSources = true
+		}
+	}
+}
+
+// groundingHosts - Hosts a grounding is known by: its domain and its URL's host
+func (f SourceFilter) groundingHosts(g *Grounding) []string {
+	hosts := make([]string, 0, 2)
+	if g.Domain != "" {
+		hosts = append(hosts, strings.ToLower(g.Domain))
+	}
+	if h := hostOf(g.URL); h != "" && !slices.Contains(f.RedirectHosts, h) {
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matchesAny - Whether any host equals a pattern or is a subdomain of it
+func matchesAny(hosts, patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(p)), "*.")
+		p = strings.TrimPrefix(p, ".")
+		if p == "" {
+			continue
+		}
+		for _, h := range hosts {
+			h = strings.TrimPrefix(h, "www.")
+			if h == p || strings.HasSuffix(h, "."+p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package searcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+// Format - Render the response in the given output format (json, markdown or text)
+func (r *SearchResponse) Format(format string) (string, error) {
+	switch format {
+	case "", config.OutputFormatJSON:
+		return r.ToJSON()
+	case config.OutputFormatMarkdown:
+		return r.ToMarkdown(), nil
+	case config.OutputFormatText:
+		return r.ToText(), nil
+	default:
+		return "", fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// ToMarkdown - Render the answer followed by a numbered "Sources" list of titled links
+func (r *SearchResponse) ToMarkdown() string {
+	var b strings.Builder
+	b.WriteString(r.Text)
+
+	// Inline citations already end the text with a numbered reference list.
+	if len(r.Groundings) > 0 && !r.citationsInserted {
+		b.WriteString("\n\n## Sources\n\n")
+		for i, g := range r.Groundings {
+			fmt.Fprintf(&b, "%d. [%s](%s)", i+1, escapeMarkdownLinkText(groundingTitle(g)), g.URL)
+			if g.Domain != "" {
+				fmt.Fprintf(&b, " — %s", g.Domain)
+			}
+			if g.Category != "" {
+				fmt.Fprintf(&b, " (%s, trust: %s)", g.Category, g.TrustTier)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	out := strings.TrimRight(b.String(), "\n")
+	if note := r.metaNote(); note != "" {
+		out += fmt.Sprintf("\n\n_%s_", note)
+	}
+	return out
+}
+
+// ToText - Render the answer followed by a plain numbered source list
+func (r *SearchResponse) ToText() string {
+	var b strings.Builder
+	b.WriteString(r.Text)
+
+	if len(r.Groundings) > 0 && !r.citationsInserted {
+		b.WriteString("\n\nSources:\n")
+		for i, g := range r.Groundings {
+			fmt.Fprintf(&b, "[%d] %s - %s\n", i+1, groundingTitle(g), g.URL)
+		}
+	}
+
+	out := strings.TrimRight(b.String(), "\n")
+	if note := r.metaNote(); note != "" {
+		out += "\n\n" + note
+	}
+	return out
+}
+
+// metaNote - One line of response metadata worth showing outside JSON
+func (r *SearchResponse) metaNote() string {
+	var notes []string
+	if r.ReliedOnFilteredSources {
+		notes = append(notes, fmt.Sprintf("Parts of this answer relied on filtered sources (%s).", strings.Join(r.FilteredSources, ", ")))
+	}
+	if r.Cached && r.CachedAt != nil {
+		notes = append(notes, fmt.Sprintf("Cached answer from %s; it may be stale.", r.CachedAt.UTC().Format(time.RFC3339)))
+	}
+	if r.ConversationID != "" {
+		notes = append(notes, fmt.Sprintf("conversation_id: %s", r.ConversationID))
+	}
+	return strings.Join(notes, " ")
+}
+
+func groundingTitle(g *Grounding) string {
+	if g.Title != "" {
+		return g.Title
+	}
+	if g.Domain != "" {
+		return g.Domain
+	}
+	return g.URL
+}
+
+func escapeMarkdownLinkText(s string) string {
+	return strings.NewReplacer("[", "\\[", "]", "\\]").Replace(s)
+}
@@ -0,0 +1,42 @@
+package searcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Turn - One earlier question and answer of a conversation, sent as history with follow-ups
+type Turn struct {
+	Question   string       `json:"question"`
+	Answer     string       `json:"answer"`
+	Groundings []*Grounding `json:"groundings,omitempty"`
+}
+
+// withHistory - Embed earlier turns ahead of a follow-up question so the model
+// can resolve references to previous answers. Returns question unchanged when
+// there is no history.
+func withHistory(question string, history []Turn) string {
+	if len(history) == 0 {
+		return question
+	}
+
+	var b strings.Builder
+	b.WriteString("<conversation_history>\n")
+	for i, turn := range history {
+		fmt.Fprintf(&b, "<turn index=\"%d\">\n", i+1)
+		fmt.Fprintf(&b, "<question>%s</question>\n", turn.Question)
+		fmt.Fprintf(&b, "<answer>%s</answer>\n", turn.Answer)
+		if len(turn.Groundings) > 0 {
+			b.WriteString("<sources>\n")
+			for _, g := range turn.Groundings {
+				fmt.Fprintf(&b, "- %s (%s)\n", g.Title, g.URL)
+			}
+			b.WriteString("</sources>\n")
+		}
+		b.WriteString("</turn>\n")
+	}
+	b.WriteString("</conversation_history>\n")
+	b.WriteString("Answer the following follow-up question in the context of the conversation above:\n")
+	b.WriteString(question)
+	return b.String()
+}
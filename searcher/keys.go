@@ -0,0 +1,144 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"go.uber.org/zap"
+)
+
+// pooledKey - One API key's client and its usage statistics
+type pooledKey struct {
+	label   string
+	backend Backend
+
+	mu           sync.Mutex
+	successes    int64
+	failures     int64
+	benchedUntil time.Time
+}
+
+// keyPool - Backend that spreads requests over several API keys,
+// benching keys that hit quota or are rejected
+type keyPool struct {
+	keys     []*pooledKey
+	strategy string
+	bench    time.Duration
+	next     atomic.Uint64
+}
+
+func newKeyPool(keys []*pooledKey, cfg *config.Config) *keyPool {
+	return &keyPool{
+		keys:     keys,
+		strategy: cfg.Gemini.KeyRotation,
+		bench:    time.Duration(cfg.Gemini.KeyBenchSeconds) * time.Second,
+	}
+}
+
+// maskAPIKey - Log-safe label for an API key
+func maskAPIKey(index int, key string) string {
+	suffix := key
+	if len(suffix) > 4 {
+		suffix = suffix[len(suffix)-4:]
+	}
+	return fmt.Sprintf("key#%d(...%s)", index+1, suffix)
+}
+
+// GenerateGroundedContentWithParams - Try keys in rotation order until one succeeds
+// or an error unrelated to the key is returned
+func (p *keyPool) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	var lastErr error
+	for _, k := range p.order() {
+		resp, err := k.backend.GenerateGroundedContentWithParams(ctx, params)
+		if err == nil {
+			k.recordSuccess()
+			return resp, nil
+		}
+
+		keyErr := isKeyError(err)
+		k.recordFailure(keyErr, p.bench)
+		lastErr = err
+		if !keyErr || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// order - Keys to try for one request: available keys first, starting from the
+// next key in round-robin order (or the first key for failover), then benched keys
+func (p *keyPool) order() []*pooledKey {
+	start := 0
+	if p.strategy != config.KeyRotationFailover {
+		start = int(p.next.Add(1)-1) % len(p.keys)
+	}
+
+	now := time.Now()
+	available := make([]*pooledKey, 0, len(p.keys))
+	benched := make([]*pooledKey, 0)
+	for i := range p.keys {
+		k := p.keys[(start+i)%len(p.keys)]
+		if k.isBenched(now) {
+			benched = append(benched, k)
+		} else {
+			available = append(available, k)
+		}
+	}
+	// When every key is benched, still try them rather than failing outright.
+	return append(available, benched...)
+}
+
+func (k *pooledKey) isBenched(now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return now.Before(k.benchedUntil)
+}
+
+func (k *pooledKey) recordSuccess() {
+	k.mu.Lock()
+	k.successes++
+	successes, failures := k.successes, k.failures
+	k.mu.Unlock()
+
+	zap.S().Infow("API key request succeeded",
+		"key", k.label,
+		"successes", successes,
+		"failures", failures)
+}
+
+func (k *pooledKey) recordFailure(bench bool, benchFor time.Duration) {
+	k.mu.Lock()
+	k.failures++
+	if bench {
+		k.benchedUntil = time.Now().Add(benchFor)
+	}
+	successes, failures := k.successes, k.failures
+	k.mu.Unlock()
+
+	zap.S().Warnw("API key request failed",
+		"key", k.label,
+		"benched", bench,
+		"bench_for", benchFor,
+		"successes", successes,
+		"failures", failures)
+}
+
+// isKeyError - Whether err is caused by the API key itself (quota exhausted,
+// unauthorized or invalid), so another key may succeed
+func isKeyError(err error) bool {
+	switch httpStatusOf(err) {
+	case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	case http.StatusBadRequest:
+		msg := err.Error()
+		return strings.Contains(msg, "API_KEY_INVALID") || strings.Contains(msg, "API key not valid")
+	}
+	return false
+}
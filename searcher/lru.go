@@ -0,0 +1,75 @@
+package searcher
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache - Size-bounded, optionally expiring LRU map safe for concurrent use
+type lruCache[V any] struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem[V any] struct {
+	key      string
+	value    V
+	storedAt time.Time
+}
+
+// newLRUCache - Create an LRU cache. A ttl of zero disables expiry.
+func newLRUCache[V any](maxEntries int, ttl time.Duration) *lruCache[V] {
+	return &lruCache[V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+// Get - Return the value for key and when it was stored
+func (c *lruCache[V]) Get(key string) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, time.Time{}, false
+	}
+	item := el.Value.(*lruItem[V])
+	if c.ttl > 0 && time.Since(item.storedAt) > c.ttl {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return zero, time.Time{}, false
+	}
+	c.ll.MoveToFront(el)
+	return item.value, item.storedAt, true
+}
+
+// Set - Store value under key, evicting the least recently used entry when full
+func (c *lruCache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*lruItem[V])
+		item.value = value
+		item.storedAt = now
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem[V]{key: key, value: value, storedAt: now})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem[V]).key)
+	}
+}
@@ -0,0 +1,38 @@
+package searcher
+
+import (
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"google.golang.org/genai"
+)
+
+// groundingMetadata - Grounding metadata of the first candidate, or nil when absent
+func groundingMetadata(result *search.Response) *genai.GroundingMetadata {
+	if len(result.Candidates) == 0 || result.Candidates[0] == nil {
+		return nil
+	}
+	return result.Candidates[0].GroundingMetadata
+}
+
+// extractSearchQueries - Web search queries the model issued to ground its answer
+func extractSearchQueries(result *search.Response) []string {
+	md := groundingMetadata(result)
+	if md == nil {
+		return nil
+	}
+	queries := make([]string, 0, len(md.WebSearchQueries))
+	for _, q := range md.WebSearchQueries {
+		if q != "" {
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+// extractSearchSuggestions - Rendered HTML of the Google Search suggestion chips
+func extractSearchSuggestions(result *search.Response) string {
+	md := groundingMetadata(result)
+	if md == nil || md.SearchEntryPoint == nil {
+		return ""
+	}
+	return md.SearchEntryPoint.RenderedContent
+}
@@ -0,0 +1,139 @@
+package searcher
+
+import (
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// rankGroundings - Merge groundings with the same normalized URL, count the
+// supports backing each one and sort them by that count, most supported first.
+// Ties keep the order Gemini returned. Support indices are remapped to match.
+func rankGroundings(r *SearchResponse) {
+	// Deduplicate, mapping every old index to the index of its first occurrence
+	byURL := map[string]int{}
+	merged := make([]*Grounding, 0, len(r.Groundings))
+	remap := make([]int, len(r.Groundings))
+	for i, g := range r.Groundings {
+		key := normalizeURL(g.URL)
+		if j, ok := byURL[key]; ok {
+			remap[i] = j
+			continue
+		}
+		byURL[key] = len(merged)
+		remap[i] = len(merged)
+		merged = append(merged, g)
+	}
+	remapSupports(r.Supports, remap)
+
+	counts := make([]int, len(merged))
+	for _, sup := range r.Supports {
+		for _, idx := range sup.GroundingIndices {
+			counts[idx]++
+		}
+	}
+
+	order := make([]int, len(merged))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return counts[order[a]] > counts[order[b]]
+	})
+
+	ranked := make([]*Grounding, len(merged))
+	remap = make([]int, len(merged))
+	for newIdx, oldIdx := range order {
+		g := merged[oldIdx]
+		g.SupportCount = counts[oldIdx]
+		ranked[newIdx] = g
+		remap[oldIdx] = newIdx
+	}
+	remapSupports(r.Supports, remap)
+
+	r.Groundings = ranked
+}
+
+// trimGroundings - Keep the first maxSources groundings and drop references to the
+// others from supports; supports left without groundings are removed
+func trimGroundings(r *SearchResponse, maxSources int) {
+	if maxSources <= 0 || len(r.Groundings) <= maxSources {
+		return
+	}
+	i := 0
+	keepGroundings(r, func(*Grounding) bool {
+		i++
+		return i <= maxSources
+	})
+}
+
+// keepGroundings - Remove the groundings rejected by keep, remapping support
+// indices and removing supports left without groundings. Returns the removed ones.
+func keepGroundings(r *SearchResponse, keep func(*Grounding) bool) []*Grounding {
+	var kept, removed []*Grounding
+	remap := make([]int, len(r.Groundings))
+	for i, g := range r.Groundings {
+		if keep(g) {
+			remap[i] = len(kept)
+			kept = append(kept, g)
+		} else {
+			remap[i] = -1
+			removed = append(removed, g)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	r.Groundings = kept
+	if r.Groundings == nil {
+		r.Groundings = []*Grounding{}
+	}
+
+	remapSupports(r.Supports, remap)
+	r.Supports = slices.DeleteFunc(r.Supports, func(sup *Support) bool {
+		return len(sup.GroundingIndices) == 0
+	})
+	return removed
+}
+
+// remapSupports - Replace grounding indices of supports using remap, removing
+// duplicates and indices remapped to -1
+func remapSupports(supports []*Support, remap []int) {
+	for _, sup := range supports {
+		indices := make([]int, 0, len(sup.GroundingIndices))
+		for _, idx := range sup.GroundingIndices {
+			if idx < 0 || idx >= len(remap) {
+				continue
+			}
+			if n := remap[idx]; n >= 0 && !slices.Contains(indices, n) {
+				indices = append(indices, n)
+			}
+		}
+		sort.Ints(indices)
+		sup.GroundingIndices = indices
+	}
+}
+
+// normalizeURL - Comparison key for a URL: case-insensitive host without "www."
+// or default port, path without trailing slash and sorted query. The scheme and
+// fragment are ignored.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && !(port == "80" && scheme == "http") && !(port == "443" && scheme == "https") {
+		host += ":" + port
+	}
+	path := strings.TrimRight(u.EscapedPath(), "/")
+
+	key := host + path
+	if u.RawQuery != "" {
+		key += "?" + u.Query().Encode()
+	}
+	return key
+}
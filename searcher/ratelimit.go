@@ -0,0 +1,146 @@
+package searcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+// ErrRateLimited - Returned when a request waited longer than allowed for the client-side rate limiter
+var ErrRateLimited = errors.New("rate limited: too many concurrent or recent Gemini requests")
+
+// rateLimitedBackend - Backend decorator with a token-bucket rate limit and a max-in-flight cap
+type rateLimitedBackend struct {
+	next    Backend
+	bucket  *tokenBucket
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+func newRateLimitedBackend(next Backend, cfg *config.Config) *rateLimitedBackend {
+	rl := cfg.Gemini.RateLimit
+	b := &rateLimitedBackend{
+		next:    next,
+		maxWait: time.Duration(rl.MaxWaitSeconds) * time.Second,
+	}
+	if rl.RequestsPerMinute > 0 {
+		b.bucket = newTokenBucket(float64(rl.RequestsPerMinute)/60, max(1, rl.Burst))
+	}
+	if rl.MaxConcurrent > 0 {
+		b.slots = make(chan struct{}, rl.MaxConcurrent)
+	}
+	return b
+}
+
+// GenerateGroundedContentWithParams - Wait for a rate limit token and a free slot, then call the wrapped backend
+func (b *rateLimitedBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	// Stop waiting at maxWait or the caller's deadline, whichever comes first.
+	var deadline time.Time
+	if b.maxWait > 0 {
+		deadline = time.Now().Add(b.maxWait)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+
+	if b.bucket != nil {
+		if err := b.bucket.wait(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.slots != nil {
+		if err := b.acquire(ctx, deadline); err != nil {
+			return nil, err
+		}
+		defer func() { <-b.slots }()
+	}
+
+	return b.next.GenerateGroundedContentWithParams(ctx, params)
+}
+
+// acquire - Take an in-flight slot, giving up at deadline (zero means wait indefinitely)
+func (b *rateLimitedBackend) acquire(ctx context.Context, deadline time.Time) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return fmt.Errorf("%w: all %d request slots busy", ErrRateLimited, cap(b.slots))
+	}
+}
+
+// tokenBucket - Token bucket refilled continuously at rate tokens per second
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait - Reserve a token and sleep until it is available. Fails without
+// consuming a token when it would not be available before deadline.
+func (tb *tokenBucket) wait(ctx context.Context, deadline time.Time) error {
+	tb.mu.Lock()
+	now := time.Now()
+	tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+
+	var delay time.Duration
+	if tb.tokens < 1 {
+		delay = time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+	}
+	if !deadline.IsZero() && now.Add(delay).After(deadline) {
+		tb.mu.Unlock()
+		return fmt.Errorf("%w: next request allowed in %s", ErrRateLimited, delay.Round(time.Second))
+	}
+	tb.tokens--
+	tb.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// Hand the reserved token back so cancelled callers do not slow others down.
+		tb.mu.Lock()
+		tb.tokens++
+		tb.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
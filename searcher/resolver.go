@@ -0,0 +1,143 @@
+package searcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"go.uber.org/zap"
+)
+
+// urlResolver - Follows grounding redirect links to the source URL with HEAD
+// requests, bounded by a per-URL timeout and a global concurrency limit
+type urlResolver struct {
+	client       *http.Client
+	hosts        []string
+	timeout      time.Duration
+	maxRedirects int
+	slots        chan struct{}
+	cache        *lruCache[string]
+}
+
+func newURLResolver(cfg *config.Config) *urlResolver {
+	rc := cfg.Gemini.URLResolver
+	hosts := make([]string, 0, len(rc.Hosts))
+	for _, h := range rc.Hosts {
+		hosts = append(hosts, strings.ToLower(strings.TrimSpace(h)))
+	}
+	return &urlResolver{
+		client: &http.Client{
+			// Redirects are followed one HEAD at a time so every hop is bounded
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		hosts:        hosts,
+		timeout:      time.Duration(rc.TimeoutSeconds) * time.Second,
+		maxRedirects: max(1, rc.MaxRedirects),
+		slots:        make(chan struct{}, max(1, rc.MaxConcurrent)),
+		cache:        newLRUCache[string](rc.CacheMaxEntries, time.Duration(rc.CacheTTLSeconds)*time.Second),
+	}
+}
+
+// resolveAll - Replace redirect URLs of groundings with their final URL, keeping
+// the redirect link in OriginalURL. URLs that fail to resolve are left unchanged.
+func (r *urlResolver) resolveAll(ctx context.Context, groundings []*Grounding) {
+	var wg sync.WaitGroup
+	for _, g := range groundings {
+		if !r.isRedirectURL(g.URL) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			final, err := r.resolve(ctx, g.URL)
+			if err != nil {
+				zap.S().Debugw("failed to resolve grounding URL",
+					"url", g.URL,
+					"error", err)
+				return
+			}
+			if final != g.URL {
+				g.OriginalURL = g.URL
+				g.URL = final
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// isRedirectURL - Whether rawURL points at one of the configured redirect hosts
+func (r *urlResolver) isRedirectURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(r.hosts, strings.ToLower(u.Hostname()))
+}
+
+// resolve - Final URL after following up to maxRedirects redirects
+func (r *urlResolver) resolve(ctx context.Context, rawURL string) (string, error) {
+	if final, _, ok := r.cache.Get(rawURL); ok {
+		return final, nil
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	// Following n redirects takes n+1 requests: the last one confirms there is no further redirect
+	current := rawURL
+	for range r.maxRedirects + 1 {
+		next, err := r.next(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if next == "" {
+			r.cache.Set(rawURL, current)
+			return current, nil
+		}
+		current = next
+	}
+	return "", fmt.Errorf("stopped after %d redirects", r.maxRedirects)
+}
+
+// next - Redirect target of one HEAD request, or "" when rawURL does not redirect
+func (r *urlResolver) next(ctx context.Context, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return "", nil
+	}
+	location, err := resp.Location()
+	if err == http.ErrNoLocation {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return location.String(), nil
+}
@@ -0,0 +1,55 @@
+package searcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+func TestURLResolverRedirectLimit(t *testing.T) {
+	// /hops/N redirects N more times before reaching /final
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := strings.TrimPrefix(r.URL.Path, "/hops/")
+		switch {
+		case r.URL.Path == "/final":
+			w.WriteHeader(http.StatusOK)
+		case n == "1":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		default:
+			http.Redirect(w, r, "/hops/"+string(n[0]-1), http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		maxRedirects int
+		hops         string
+		wantErr      bool
+	}{
+		{maxRedirects: 1, hops: "1"},
+		{maxRedirects: 1, hops: "2", wantErr: true},
+		{maxRedirects: 5, hops: "5"},
+		{maxRedirects: 5, hops: "6", wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{}
+		cfg.Gemini.URLResolver.Hosts = []string{"127.0.0.1"}
+		cfg.Gemini.URLResolver.MaxRedirects = tt.maxRedirects
+		r := newURLResolver(cfg)
+
+		final, err := r.resolve(context.Background(), srv.URL+"/hops/"+tt.hops)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("max_redirects %d, %s hops: resolved to %s, want an error", tt.maxRedirects, tt.hops, final)
+			}
+			continue
+		}
+		if err != nil || final != srv.URL+"/final" {
+			t.Errorf("max_redirects %d, %s hops: got %q, %v, want %s/final", tt.maxRedirects, tt.hops, final, err, srv.URL)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package searcher
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"go.uber.org/zap"
+)
+
+// retryBackend - Backend decorator that retries transient failures with exponential backoff
+type retryBackend struct {
+	next        Backend
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	jitter      float64
+}
+
+func newRetryBackend(next Backend, cfg *config.Config) *retryBackend {
+	return &retryBackend{
+		next:        next,
+		maxAttempts: max(1, cfg.Gemini.Retry.MaxAttempts),
+		baseDelay:   time.Duration(cfg.Gemini.Retry.BaseDelayMs) * time.Millisecond,
+		maxDelay:    time.Duration(cfg.Gemini.Retry.MaxDelayMs) * time.Millisecond,
+		jitter:      min(max(cfg.Gemini.Retry.Jitter, 0), 1),
+	}
+}
+
+// GenerateGroundedContentWithParams - Call the wrapped backend, retrying transient errors
+func (b *retryBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := b.next.GenerateGroundedContentWithParams(ctx, params)
+		if err == nil || attempt >= b.maxAttempts || ctx.Err() != nil || !isRetryableError(err) {
+			return resp, err
+		}
+
+		delay := b.backoff(attempt)
+		if retryAfter := retryAfterOf(err); retryAfter > delay {
+			delay = retryAfter
+		}
+
+		// Give up early rather than sleeping past the caller's deadline.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			zap.S().Warnw("not retrying search, deadline too close",
+				"attempt", attempt,
+				"delay", delay,
+				"error", err)
+			return nil, err
+		}
+
+		zap.S().Warnw("retrying search after transient error",
+			"attempt", attempt,
+			"max_attempts", b.maxAttempts,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff - Delay before the next attempt: baseDelay * 2^(attempt-1), capped and jittered
+func (b *retryBackend) backoff(attempt int) time.Duration {
+	delay := b.baseDelay << (attempt - 1)
+	if b.maxDelay > 0 && (delay > b.maxDelay || delay <= 0) {
+		delay = b.maxDelay
+	}
+	if b.jitter > 0 {
+		// Spread delays over [1-jitter, 1+jitter] to avoid synchronized retries.
+		delay = time.Duration(float64(delay) * (1 + b.jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
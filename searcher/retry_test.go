@@ -0,0 +1,102 @@
+package searcher
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"google.golang.org/genai"
+	"google.golang.org/grpc/codes"
+)
+
+// wrapped - Error as returned by the library, wrapping err with codes.Unknown
+func wrapped(err error) error {
+	return &search.APIError{StatusCode: codes.Unknown, Message: "request failed", Err: err}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"rate limited", wrapped(genai.APIError{Code: 429}), true},
+		{"server error", wrapped(genai.APIError{Code: 500}), true},
+		{"unavailable", wrapped(genai.APIError{Code: 503}), true},
+		{"bad request", wrapped(genai.APIError{Code: 400}), false},
+		{"forbidden", wrapped(genai.APIError{Code: 403}), false},
+		{"grpc unavailable", &search.APIError{StatusCode: codes.Unavailable}, true},
+		{"grpc internal", &search.APIError{StatusCode: codes.Internal}, true},
+		{"grpc invalid argument", &search.APIError{StatusCode: codes.InvalidArgument}, false},
+		{"dns failure", wrapped(&net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), false},
+		{"dns timeout", wrapped(&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}), true},
+		{"certificate", wrapped(x509.UnknownAuthorityError{}), false},
+		{"unknown without cause", &search.APIError{StatusCode: codes.Unknown}, false},
+		{"deadline", fmt.Errorf("search: %w", context.DeadlineExceeded), true},
+		{"canceled", wrapped(context.Canceled), false},
+		{"content blocked", fmt.Errorf("search: %w", search.ErrContentBlocked), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := &retryBackend{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		70: time.Second, // the shift overflows
+	} {
+		if got := b.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	b.jitter = 0.5
+	for range 100 {
+		if got := b.backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("backoff(2) with jitter 0.5 = %v, want within [100ms, 300ms]", got)
+		}
+	}
+}
+
+func TestRetryAfterOf(t *testing.T) {
+	retryInfo := func(delay string) error {
+		return wrapped(genai.APIError{Code: 429, Details: []map[string]any{
+			{"@type": "type.googleapis.com/google.rpc.QuotaFailure"},
+			{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": delay},
+		}})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"retry info", retryInfo("7s"), 7 * time.Second},
+		{"fractional", retryInfo("1.5s"), 1500 * time.Millisecond},
+		{"malformed delay", retryInfo("soon"), 0},
+		{"zero delay", retryInfo("0s"), 0},
+		{"no details", wrapped(genai.APIError{Code: 429}), 0},
+		{"not an API error", errors.New("boom"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfterOf(tt.err); got != tt.want {
+				t.Errorf("retryAfterOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
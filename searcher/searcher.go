@@ -3,27 +3,112 @@ package searcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	search "github.com/cnosuke/go-gemini-grounded-search"
 	"github.com/cnosuke/mcp-gemini-grounded-search/config"
 	ierrors "github.com/cnosuke/mcp-gemini-grounded-search/internal/errors"
+	"github.com/cnosuke/mcp-gemini-grounded-search/internal/prompt"
 	"go.uber.org/zap"
 )
 
+// ErrSearchTimeout - Returned when a search does not finish within its timeout
+var ErrSearchTimeout = errors.New("search timed out")
+
+// ErrUnknownTemplate - Returned when a search names a query template that is not configured
+var ErrUnknownTemplate = errors.New("unknown query template")
+
 // Searcher - Search interface
 type Searcher struct {
-	client *search.Client
+	backend Backend
+	cache   Cache
+	budget  *budget
+	// resolver replaces grounding redirect links with source URLs, nil when disabled
+	resolver *urlResolver
+	// credibility classifies grounding domains, nil when no table is configured
+	credibility *credibilityTable
+	// now is the clock for the date and time in prompts
+	now func() time.Time
 
 	DefaultModel         string
+	FallbackModels       []string
 	DefaultMaxTokens     int
-	DefaultQueryTemplate string
+	DefaultThinkingLevel string
+	QueryTemplates       map[string]*prompt.Template
+	DefaultTemplate      string
+	DefaultLocale        string
+	Location             *time.Location
+	DatePreamble         bool
+	DefaultTimeout       time.Duration
+	MaxTimeout           time.Duration
+	DefaultCitations     bool
+	DefaultOutputFormat  string
+	SearchSuggestions    bool
+	SourceFilter         SourceFilter
+}
+
+// SearchOptions - Per-call options for Search. Zero values fall back to server defaults.
+type SearchOptions struct {
+	MaxTokens     int
+	ThinkingLevel string
+	// Timeout bounds the whole search; it is clamped to Searcher.MaxTimeout
+	Timeout time.Duration
+	// History holds earlier turns when the query is a follow-up question
+	History []Turn
+	// Citations inserts [n] markers and a numbered reference list into the answer text
+	Citations bool
+	// MaxSources keeps only the most supported groundings; zero keeps all
+	MaxSources int
+	// IncludeDomains keeps only groundings from these domains, on top of the server filter
+	IncludeDomains []string
+	// ExcludeDomains removes groundings from these domains, on top of the server filter
+	ExcludeDomains []string
+	// Template names the query template; empty selects DefaultTemplate
+	Template string
+	// Locale is the preferred answer locale available to templates; empty selects DefaultLocale
+	Locale string
+	// Context is extra caller-supplied context available to templates
+	Context string
 }
 
 // SearchResponse - Response for search results
 type SearchResponse struct {
 	Text       string       `json:"text"`
 	Groundings []*Grounding `json:"groundings"`
+	// Supports links segments of Text to the Groundings backing them
+	Supports []*Support `json:"supports,omitempty"`
+	// ConversationID identifies the conversation to continue with follow-up questions
+	ConversationID string `json:"conversation_id,omitempty"`
+	// SearchQueries are the web search queries the model ran to ground the answer
+	SearchQueries []string `json:"search_queries,omitempty"`
+	// SearchSuggestions is the rendered Google Search suggestion HTML, when enabled
+	SearchSuggestions string `json:"search_suggestions_html,omitempty"`
+	// FilteredSources lists domains of groundings removed by the source filter
+	FilteredSources []string `json:"filtered_sources,omitempty"`
+	// ReliedOnFilteredSources is set when a removed grounding supported part of the answer
+	ReliedOnFilteredSources bool `json:"relied_on_filtered_sources,omitempty"`
+	// Template is the name of the query template the question was sent with
+	Template string `json:"template,omitempty"`
+	// Model is the model that actually answered, which may be a fallback model
+	Model string `json:"model,omitempty"`
+	// Usage reports tokens and latency of the Gemini call; for cached
+	// responses it describes the original call
+	Usage *Usage `json:"usage,omitempty"`
+	// Cached is set when the response was served from the cache and may be stale
+	Cached   bool       `json:"cached,omitempty"`
+	CachedAt *time.Time `json:"cached_at,omitempty"`
+	// Coalesced is set when the response came from an identical search another
+	// caller had in flight; that caller is charged for the Gemini call
+	Coalesced bool `json:"coalesced,omitempty"`
+
+	// citationsInserted is set once Text ends with a numbered reference list
+	citationsInserted bool
+	// answer is Text as it was before citations were inserted
+	answer string
 }
 
 // Grounding - Information about the source of the search content
@@ -31,63 +116,224 @@ type Grounding struct {
 	Title  string `json:"title"`
 	Domain string `json:"domain"`
 	URL    string `json:"url"`
+	// OriginalURL is the redirect link returned by Gemini when URL was resolved from it
+	OriginalURL string `json:"original_url,omitempty"`
+	// SupportCount is the number of answer segments this source supports
+	SupportCount int `json:"support_count"`
+	// Category and TrustTier classify the domain per the credibility table
+	Category  string `json:"category,omitempty"`
+	TrustTier string `json:"trust_tier,omitempty"`
 }
 
 // NewSearcher - Create a new Searcher
 func NewSearcher(ctx context.Context, cfg *config.Config) (*Searcher, error) {
 	zap.S().Infow("creating new Searcher",
-		"model_name", cfg.Gemini.ModelName)
+		"model_name", cfg.Gemini.ModelName,
+		"backend", cfg.Gemini.Backend)
+
+	backend, err := newBackend(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSearcherWithBackend(backend, cfg)
+
+	s.cache, err = newCache(cfg)
+	if err != nil {
+		return nil, ierrors.Wrap(err, "failed to create response cache")
+	}
 
-	opts := []search.ClientOption{
-		search.WithModelName(cfg.Gemini.ModelName),
-		search.WithNoRedirection(),
+	if cfg.Gemini.URLResolver.Enabled {
+		s.resolver = newURLResolver(cfg)
 	}
 
-	if tc := buildThinkingConfig(cfg); tc != nil {
-		opts = append(opts, search.WithDefaultThinkingConfig(tc))
-		budgetLog := "<nil>"
-		if tc.ThinkingBudget != nil {
-			budgetLog = fmt.Sprintf("%d", *tc.ThinkingBudget)
+	if cfg.Credibility.File != "" {
+		table, err := config.LoadCredibility(cfg.Credibility.File)
+		if err != nil {
+			return nil, ierrors.Wrap(err, "failed to load credibility table "+cfg.Credibility.File)
 		}
-		zap.S().Infow("ThinkingConfig enabled",
-			"thinking_level", tc.ThinkingLevel,
-			"thinking_budget", budgetLog)
+		s.credibility = &credibilityTable{table: table}
+		zap.S().Infow("credibility table loaded",
+			"file", cfg.Credibility.File,
+			"domains", len(table.Domains))
 	}
 
-	client, err := search.NewClient(ctx, cfg.Gemini.APIKey, opts...)
+	s.budget, err = newBudget(cfg)
 	if err != nil {
-		return nil, ierrors.Wrap(err, "failed to create Gemini client")
+		return nil, ierrors.Wrap(err, "failed to load budgets")
 	}
 
+	return s, nil
+}
+
+// NewSearcherWithBackend - Create a new Searcher that uses the given backend
+func NewSearcherWithBackend(backend Backend, cfg *config.Config) *Searcher {
 	defaultMaxTokens := cfg.Gemini.MaxTokens
 	if defaultMaxTokens <= 0 {
 		defaultMaxTokens = 5000 // Default value if not set
 	}
 
+	// Templates are validated by config.LoadConfig; one that still fails to parse is left out
+	templates := map[string]*prompt.Template{}
+	for name, text := range cfg.QueryTemplates() {
+		t, err := prompt.Parse(name, text)
+		if err != nil {
+			zap.S().Errorw("skipping invalid query template",
+				"template", name,
+				"error", err)
+			continue
+		}
+		templates[name] = t
+	}
+
+	// The timezone is validated by config.LoadConfig as well
+	location, err := time.LoadLocation(cfg.Gemini.Timezone)
+	if err != nil {
+		zap.S().Errorw("invalid timezone, using UTC",
+			"timezone", cfg.Gemini.Timezone,
+			"error", err)
+		location = time.UTC
+	}
+
 	return &Searcher{
-		client:               client,
+		backend:              backend,
+		now:                  time.Now,
 		DefaultMaxTokens:     defaultMaxTokens,
 		DefaultModel:         cfg.Gemini.ModelName,
-		DefaultQueryTemplate: cfg.Gemini.QueryTemplate,
-	}, nil
+		FallbackModels:       cfg.FallbackModelNames(),
+		DefaultThinkingLevel: cfg.Gemini.ThinkingLevel,
+		QueryTemplates:       templates,
+		DefaultTemplate:      cfg.Gemini.DefaultTemplate,
+		DefaultLocale:        cfg.Gemini.Locale,
+		Location:             location,
+		DatePreamble:         cfg.Gemini.DatePreamble,
+		DefaultTimeout:       time.Duration(cfg.Gemini.TimeoutSeconds) * time.Second,
+		MaxTimeout:           time.Duration(cfg.Gemini.MaxTimeoutSeconds) * time.Second,
+		DefaultCitations:     cfg.Tools.InlineCitations,
+		DefaultOutputFormat:  cfg.Tools.OutputFormat,
+		SearchSuggestions:    cfg.Tools.SearchSuggestions,
+		SourceFilter: SourceFilter{
+			Allow:         cfg.Gemini.SourceFilter.Allow,
+			Deny:          cfg.Gemini.SourceFilter.Deny,
+			RedirectHosts: cfg.Gemini.URLResolver.Hosts,
+		},
+	}
 }
 
-// Search - Perform a search with the given query and max token limit
-func (s *Searcher) Search(ctx context.Context, query string, maxTokens int, thinkingLevel string) (*SearchResponse, error) {
+// Search - Perform a search with the given query and options
+func (s *Searcher) Search(ctx context.Context, query string, opts SearchOptions) (*SearchResponse, error) {
+	maxTokens := opts.MaxTokens
 	if maxTokens <= 0 {
 		maxTokens = s.DefaultMaxTokens
 	}
+	thinkingLevel := opts.ThinkingLevel
+	templateName, template, err := s.queryTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	opts.Template = templateName
+	locale := opts.Locale
+	if locale == "" {
+		locale = s.DefaultLocale
+	}
+	vars := prompt.At(s.now().In(s.Location))
+	vars.Question = query
+	vars.Locale = locale
+	vars.Context = opts.Context
+	timeout := s.EffectiveTimeout(opts.Timeout)
 	zap.S().Debugw("executing search",
 		"query", query,
 		"max_tokens", maxTokens,
-		"thinking_level", thinkingLevel)
+		"thinking_level", thinkingLevel,
+		"template", templateName,
+		"timeout", timeout)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	effectiveThinkingLevel := thinkingLevel
+	if effectiveThinkingLevel == "" {
+		effectiveThinkingLevel = s.DefaultThinkingLevel
+	}
+	// Follow-ups depend on their history, which the cache key does not cover.
+	useCache := s.cache != nil && len(opts.History) == 0
+	key := cacheKey(query, promptKey(template, vars), s.DefaultModel, maxTokens, effectiveThinkingLevel)
+	if useCache {
+		if cached, storedAt, ok := s.cache.Get(key); ok {
+			zap.S().Debugw("serving search from cache",
+				"query", query,
+				"stored_at", storedAt)
+			cached.Cached = true
+			cached.CachedAt = &storedAt
+			return s.finalize(cached, opts), nil
+		}
+	}
+
+	// Cached answers are free; anything that reaches Gemini counts against the budgets.
+	principal := principalFromContext(ctx)
+	if s.budget != nil {
+		if err := s.budget.reserve(principal); err != nil {
+			zap.S().Warnw("search rejected by budget",
+				"principal", principal,
+				"error", err)
+			return nil, err
+		}
+	}
+
+	ctx, call := withCallInfo(ctx)
+	response, err := s.fetch(ctx, template, vars, maxTokens, thinkingLevel, opts.History)
+	if s.budget != nil {
+		switch {
+		case err != nil && !call.reached:
+			// Nothing reached Gemini, e.g. rate limited locally, a cassette miss or a failed joined call
+			s.budget.release(principal)
+		case err != nil:
+		case response.Coalesced:
+			// A joined call is free like a cached answer; its tokens are charged to the caller that made it
+			s.budget.release(principal)
+		case response.Usage != nil:
+			s.budget.record(principal, response.Usage.TotalTokens)
+		}
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if timeout > 0 {
+				return nil, fmt.Errorf("%w after %s: %v", ErrSearchTimeout, timeout, err)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrSearchTimeout, err)
+		}
+		return nil, err
+	}
+
+	// The caller that made the call caches its response
+	if useCache && !response.Coalesced {
+		s.cache.Set(key, response)
+	}
+
+	return s.finalize(response, opts), nil
+}
 
+// fetch - Expand the query into a prompt, call the backend and convert its result
+func (s *Searcher) fetch(ctx context.Context, template *prompt.Template, vars prompt.Vars, maxTokens int, thinkingLevel string, history []Turn) (*SearchResponse, error) {
 	zero := float32(0.0)
 	t := int32(maxTokens)
 
-	if s.DefaultQueryTemplate != "" {
-		query = fmt.Sprintf(s.DefaultQueryTemplate, query)
+	ctx = withQuestion(ctx, vars.Question)
+	vars.Question = withHistory(vars.Question, history)
+	query, err := s.buildPrompt(template, vars)
+	if err != nil {
+		return nil, err
+	}
+	// Cassettes identify the request by its prompt without the current date and
+	// time, so recordings replay on any day
+	timeless, err := s.buildPrompt(template, vars.Timeless())
+	if err != nil {
+		return nil, err
 	}
+	ctx = withCassettePrompt(ctx, timeless)
 
 	// Set parameters for the search
 	params := &search.GenerationParams{
@@ -104,23 +350,22 @@ func (s *Searcher) Search(ctx context.Context, query string, maxTokens int, thin
 	}
 
 	// Execute the search
-	result, err := s.client.GenerateGroundedContentWithParams(ctx, params)
+	start := time.Now()
+	result, model, err := s.generate(ctx, params)
 	if err != nil {
-		if apiErr, ok := search.GetAPIError(err); ok {
-			zap.S().Errorw("API error in search",
-				"status_code", apiErr.StatusCode,
-				"message", apiErr.Message)
-		} else if search.IsContentBlockedError(err) {
-			zap.S().Errorw("content blocked error in search",
-				"error", err)
-		}
 		return nil, ierrors.Wrap(err, "failed to generate grounded content")
 	}
 
 	// Create response
 	response := &SearchResponse{
-		Text:       result.GeneratedText,
-		Groundings: make([]*Grounding, 0, len(result.GroundingAttributions)),
+		Text:              result.GeneratedText,
+		Groundings:        make([]*Grounding, 0, len(result.GroundingAttributions)),
+		Supports:          extractSupports(result),
+		SearchQueries:     extractSearchQueries(result),
+		SearchSuggestions: extractSearchSuggestions(result),
+		Model:             model,
+		Usage:             extractUsage(result, model, time.Since(start)),
+		Coalesced:         callInfoFrom(ctx).joined,
 	}
 
 	// Add groundings
@@ -132,38 +377,132 @@ func (s *Searcher) Search(ctx context.Context, query string, maxTokens int, thin
 		})
 	}
 
+	if s.resolver != nil {
+		s.resolver.resolveAll(ctx, response.Groundings)
+	}
+	rankGroundings(response)
+
 	return response, nil
 }
 
-func buildThinkingConfig(cfg *config.Config) *search.ThinkingConfig {
-	hasLevel := cfg.Gemini.ThinkingLevel != ""
-	hasBudget := cfg.Gemini.ThinkingBudget != nil
+// buildPrompt - Expand the query template and prepend the date preamble when enabled
+func (s *Searcher) buildPrompt(template *prompt.Template, vars prompt.Vars) (string, error) {
+	query := vars.Question
+	if template != nil {
+		var err error
+		if query, err = template.Execute(vars); err != nil {
+			return "", err
+		}
+	}
+	if s.DatePreamble {
+		query = prompt.Preamble(vars) + "\n\n" + query
+	}
+	return query, nil
+}
 
-	if !hasLevel && !hasBudget {
-		return nil
+// finalize - Apply per-call output options to a fresh or cached response
+func (s *Searcher) finalize(response *SearchResponse, opts SearchOptions) *SearchResponse {
+	response.Template = opts.Template
+	// Suggestions are always cached so enabling them does not require a cache flush
+	if !s.SearchSuggestions {
+		response.SearchSuggestions = ""
+	}
+	if s.credibility != nil {
+		s.credibility.annotate(response.Groundings)
+	}
+	s.SourceFilter.applyFilter(response, opts.IncludeDomains, opts.ExcludeDomains)
+	trimGroundings(response, opts.MaxSources)
+	if opts.Citations {
+		insertCitations(response)
+	}
+	return response
+}
+
+// queryTemplate - Resolve a template name, empty for DefaultTemplate. Without
+// any configured template the question is sent as is and the name is empty.
+func (s *Searcher) queryTemplate(name string) (string, *prompt.Template, error) {
+	if name == "" {
+		name = s.DefaultTemplate
+		if _, ok := s.QueryTemplates[name]; !ok {
+			return "", nil, nil
+		}
 	}
+	template, ok := s.QueryTemplates[name]
+	if !ok {
+		return "", nil, fmt.Errorf("%w %q (available: %s)", ErrUnknownTemplate, name, strings.Join(s.TemplateNames(), ", "))
+	}
+	return name, template, nil
+}
 
-	tc := &search.ThinkingConfig{}
+// TemplateNames - Names of the configured query templates in sorted order
+func (s *Searcher) TemplateNames() []string {
+	names := make([]string, 0, len(s.QueryTemplates))
+	for name := range s.QueryTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	if hasLevel {
-		tc.ThinkingLevel = search.ThinkingLevel(cfg.Gemini.ThinkingLevel)
+// EffectiveTimeout - Timeout applied to a search given the requested one:
+// the default when none is requested, never more than MaxTimeout
+func (s *Searcher) EffectiveTimeout(requested time.Duration) time.Duration {
+	timeout := requested
+	if timeout <= 0 {
+		timeout = s.DefaultTimeout
+	}
+	if s.MaxTimeout > 0 && (timeout <= 0 || timeout > s.MaxTimeout) {
+		timeout = s.MaxTimeout
 	}
+	return timeout
+}
 
-	if hasBudget {
-		b := *cfg.Gemini.ThinkingBudget
-		if b < 0 || b > int(^int32(0)>>1) {
-			zap.S().Warnw("thinking_budget out of int32 range, clamping", "original", b)
-			if b < 0 {
-				b = 0
-			} else {
-				b = int(^int32(0) >> 1)
+// generate - Call the backend with the primary model, falling back to
+// FallbackModels in order when a model is exhausted, missing or overloaded.
+// Returns the response and the model that produced it.
+func (s *Searcher) generate(ctx context.Context, params *search.GenerationParams) (*search.Response, string, error) {
+	models := append([]string{params.ModelName}, s.FallbackModels...)
+
+	var err error
+	for i, model := range models {
+		p := *params
+		p.ModelName = model
+
+		var result *search.Response
+		result, err = s.backend.GenerateGroundedContentWithParams(ctx, &p)
+		if err == nil {
+			if i > 0 {
+				zap.S().Infow("search answered by fallback model",
+					"model", model,
+					"primary_model", params.ModelName)
 			}
+			return result, model, nil
+		}
+
+		if apiErr, ok := search.GetAPIError(err); ok {
+			zap.S().Errorw("API error in search",
+				"model", model,
+				"status_code", apiErr.StatusCode,
+				"http_status", httpStatusOf(err),
+				"message", apiErr.Message)
+		} else if search.IsContentBlockedError(err) {
+			zap.S().Errorw("content blocked error in search",
+				"model", model,
+				"error", err)
+		}
+
+		if ctx.Err() != nil || !isFallbackError(err) {
+			break
+		}
+		if i+1 < len(models) {
+			zap.S().Warnw("falling back to next model",
+				"failed_model", model,
+				"next_model", models[i+1],
+				"error", err)
 		}
-		budget := int32(b)
-		tc.ThinkingBudget = &budget
 	}
 
-	return tc
+	return nil, "", err
 }
 
 // ToJSON - Convert search response to JSON string
@@ -174,3 +513,8 @@ func (r *SearchResponse) ToJSON() (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// normalizeQuestion - Lowercase and collapse whitespace so matching ignores formatting
+func normalizeQuestion(q string) string {
+	return strings.Join(strings.Fields(strings.ToLower(q)), " ")
+}
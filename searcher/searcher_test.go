@@ -0,0 +1,21 @@
+package searcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+func TestFallbackModelsSkipOverriddenPrimary(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Gemini.ModelName = "gemini-pro"
+	cfg.Gemini.FallbackModels = []string{"gemini-flash", " gemini-pro ", "", "gemini-flash", "gemini-lite"}
+	// As main does for --model after the configuration is loaded
+	cfg.Gemini.ModelName = "gemini-flash"
+
+	s := NewSearcherWithBackend(newDeadlineBackend(), cfg)
+	if want := []string{"gemini-pro", "gemini-lite"}; !reflect.DeepEqual(s.FallbackModels, want) {
+		t.Errorf("FallbackModels = %q, want %q", s.FallbackModels, want)
+	}
+}
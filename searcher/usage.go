@@ -0,0 +1,35 @@
+package searcher
+
+import (
+	"time"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+)
+
+// Usage - Token usage and latency of the Gemini call that produced a response
+type Usage struct {
+	Model            string `json:"model"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CandidatesTokens int    `json:"candidates_tokens"`
+	ThinkingTokens   int    `json:"thinking_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	LatencyMs        int64  `json:"latency_ms"`
+}
+
+// extractUsage - Usage of a backend result. Token counts are zero when the
+// backend reports no usage metadata (e.g. the fake backend).
+func extractUsage(result *search.Response, model string, latency time.Duration) *Usage {
+	usage := &Usage{
+		Model:     model,
+		LatencyMs: latency.Milliseconds(),
+	}
+	if result.RawResponse == nil || result.RawResponse.UsageMetadata == nil {
+		return usage
+	}
+	md := result.RawResponse.UsageMetadata
+	usage.PromptTokens = int(md.PromptTokenCount)
+	usage.CandidatesTokens = int(md.CandidatesTokenCount)
+	usage.ThinkingTokens = int(md.ThoughtsTokenCount)
+	usage.TotalTokens = int(md.TotalTokenCount)
+	return usage
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"github.com/cnosuke/mcp-gemini-grounded-search/searcher"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// conversation - Turns of one conversation owned by an MCP session
+type conversation struct {
+	sessionID string
+	turns     []searcher.Turn
+	updatedAt time.Time
+}
+
+// conversationStore - In-memory conversations scoped to MCP sessions with TTL and size limits
+type conversationStore struct {
+	ttl           time.Duration
+	maxTurns      int
+	maxPerSession int
+
+	mu            sync.Mutex
+	conversations map[string]*conversation
+}
+
+func newConversationStore(cfg *config.Config) *conversationStore {
+	return &conversationStore{
+		ttl:           time.Duration(cfg.Conversations.TTLSeconds) * time.Second,
+		maxTurns:      cfg.Conversations.MaxTurns,
+		maxPerSession: cfg.Conversations.MaxPerSession,
+		conversations: map[string]*conversation{},
+	}
+}
+
+// sessionIDFromContext - ID of the MCP session making the request, or "" when unknown
+func sessionIDFromContext(ctx context.Context) string {
+	if session := mcpserver.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// start - Create a conversation with its first turn and return its ID
+func (cs *conversationStore) start(sessionID string, turn searcher.Turn) string {
+	id := newConversationID()
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.expire(time.Now())
+	cs.evictForSession(sessionID)
+	cs.conversations[id] = &conversation{
+		sessionID: sessionID,
+		turns:     []searcher.Turn{turn},
+		updatedAt: time.Now(),
+	}
+	return id
+}
+
+// history - Copy of the turns of a conversation visible to sessionID
+func (cs *conversationStore) history(sessionID, id string) ([]searcher.Turn, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.expire(time.Now())
+	c, ok := cs.conversations[id]
+	if !ok || c.sessionID != sessionID {
+		return nil, false
+	}
+	return append([]searcher.Turn(nil), c.turns...), true
+}
+
+// append - Add a turn to a conversation, keeping at most maxTurns recent turns
+func (cs *conversationStore) append(sessionID, id string, turn searcher.Turn) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	c, ok := cs.conversations[id]
+	if !ok || c.sessionID != sessionID {
+		return false
+	}
+	c.turns = append(c.turns, turn)
+	if cs.maxTurns > 0 && len(c.turns) > cs.maxTurns {
+		c.turns = c.turns[len(c.turns)-cs.maxTurns:]
+	}
+	c.updatedAt = time.Now()
+	return true
+}
+
+// expire - Drop conversations idle for longer than ttl. Caller holds mu.
+func (cs *conversationStore) expire(now time.Time) {
+	if cs.ttl <= 0 {
+		return
+	}
+	for id, c := range cs.conversations {
+		if now.Sub(c.updatedAt) > cs.ttl {
+			delete(cs.conversations, id)
+		}
+	}
+}
+
+// evictForSession - Drop the least recently used conversations of a session
+// so a new one fits within maxPerSession. Caller holds mu.
+func (cs *conversationStore) evictForSession(sessionID string) {
+	if cs.maxPerSession <= 0 {
+		return
+	}
+	for {
+		var count int
+		var oldestID string
+		var oldest time.Time
+		for id, c := range cs.conversations {
+			if c.sessionID != sessionID {
+				continue
+			}
+			count++
+			if oldestID == "" || c.updatedAt.Before(oldest) {
+				oldestID, oldest = id, c.updatedAt
+			}
+		}
+		if count < cs.maxPerSession {
+			return
+		}
+		delete(cs.conversations, oldestID)
+	}
+}
+
+func newConversationID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -18,7 +18,7 @@ import (
 func RunHTTP(cfg *config.Config, name string, version string, revision string) error {
 	zap.S().Infow("starting MCP Gemini Grounded Search Server (HTTP)")
 
-	s, _, err := createMCPServer(cfg, name, version, revision)
+	s, usage, err := createMCPServer(cfg, name, version, revision)
 	if err != nil {
 		return err
 	}
@@ -34,13 +34,15 @@ func RunHTTP(cfg *config.Config, name string, version string, revision string) e
 	// Order: withOriginValidation (outer) → withAuthMiddleware (inner) → httpServer
 	// This allows CORS preflight (OPTIONS without Authorization) to be handled
 	// by withOriginValidation before reaching the auth check.
+	tokens := authTokens(cfg)
 	var mcpHandler http.Handler = httpServer
-	mcpHandler = withAuthMiddleware(mcpHandler, cfg.HTTP.AuthToken)
+	mcpHandler = withAuthMiddleware(mcpHandler, tokens)
 	mcpHandler = withOriginValidation(mcpHandler, cfg.HTTP.AllowedOrigins)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", handleHealth)
 	mux.Handle(cfg.HTTP.EndpointPath, mcpHandler)
+	mux.Handle("/usage", withAuthMiddleware(http.HandlerFunc(usage.handleUsage), tokens))
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.HTTP.Port),
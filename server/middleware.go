@@ -3,22 +3,44 @@ package server
 import (
 	"net/http"
 	"slices"
+	"strings"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"github.com/cnosuke/mcp-gemini-grounded-search/searcher"
 )
 
-func withAuthMiddleware(next http.Handler, authToken string) http.Handler {
-	if authToken == "" {
+// withAuthMiddleware - Require one of the bearer tokens and attach its name to the
+// request context as the principal per-token budgets are tracked for
+func withAuthMiddleware(next http.Handler, tokens map[string]string) http.Handler {
+	if len(tokens) == 0 {
 		return next
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token != "Bearer "+authToken {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		name, known := tokens[token]
+		if !ok || !known {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(searcher.WithPrincipal(r.Context(), name)))
 	})
 }
 
+// authTokens - Accepted bearer tokens mapped to their names: http.auth_token is
+// named "default", http.auth_tokens maps names to tokens
+func authTokens(cfg *config.Config) map[string]string {
+	tokens := map[string]string{}
+	if cfg.HTTP.AuthToken != "" {
+		tokens[cfg.HTTP.AuthToken] = "default"
+	}
+	for name, token := range cfg.HTTP.AuthTokens {
+		if token != "" {
+			tokens[token] = name
+		}
+	}
+	return tokens
+}
+
 func withOriginValidation(next http.Handler, allowedOrigins []string) http.Handler {
 	if len(allowedOrigins) == 0 {
 		return next
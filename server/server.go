@@ -12,7 +12,8 @@ import (
 )
 
 // createMCPServer creates and configures an MCP server instance with all tools registered.
-func createMCPServer(cfg *config.Config, name, version, revision string) (*mcpserver.MCPServer, *searcher.Searcher, error) {
+// The returned usage tracker aggregates search usage per session and per day.
+func createMCPServer(cfg *config.Config, name, version, revision string) (*mcpserver.MCPServer, *usageTracker, error) {
 	versionString := version
 	if revision != "" && revision != "xxx" {
 		versionString = versionString + " (" + revision + ")"
@@ -26,6 +27,8 @@ func createMCPServer(cfg *config.Config, name, version, revision string) (*mcpse
 		return nil, nil, err
 	}
 
+	usage := newUsageTracker(cfg)
+
 	hooks := &mcpserver.Hooks{}
 	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
 		zap.S().Errorw("MCP error occurred",
@@ -34,17 +37,20 @@ func createMCPServer(cfg *config.Config, name, version, revision string) (*mcpse
 			"error", err,
 		)
 	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session mcpserver.ClientSession) {
+		usage.endSession(session.SessionID())
+	})
 
 	zap.S().Debugw("creating MCP server", "name", name, "version", versionString)
 	s := mcpserver.NewMCPServer(name, versionString, mcpserver.WithHooks(hooks))
 
 	zap.S().Debugw("registering tools")
-	if err := RegisterAllTools(s, searcherInstance); err != nil {
+	if err := RegisterAllTools(s, searcherInstance, cfg, usage); err != nil {
 		zap.S().Errorw("failed to register tools", "error", err)
 		return nil, nil, err
 	}
 
-	return s, searcherInstance, nil
+	return s, usage, nil
 }
 
 // RunStdio starts the MCP server with stdio transport.
@@ -2,8 +2,13 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
 	"github.com/cnosuke/mcp-gemini-grounded-search/searcher"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -11,9 +16,21 @@ import (
 )
 
 // RegisterAllTools - Register all tools with the server
-func RegisterAllTools(m *server.MCPServer, s *searcher.Searcher) error {
+func RegisterAllTools(m *server.MCPServer, s *searcher.Searcher, cfg *config.Config, usage *usageTracker) error {
+	conversations := newConversationStore(cfg)
+
 	// Register search tool
-	if err := registerSearchTool(m, s); err != nil {
+	if err := registerSearchTool(m, s, conversations, usage); err != nil {
+		return err
+	}
+
+	// Register follow_up tool
+	if err := registerFollowUpTool(m, s, conversations, usage); err != nil {
+		return err
+	}
+
+	// Register batch search tool
+	if err := registerBatchSearchTool(m, s, cfg, usage); err != nil {
 		return err
 	}
 
@@ -21,7 +38,7 @@ func RegisterAllTools(m *server.MCPServer, s *searcher.Searcher) error {
 }
 
 // registerSearchTool - Register the search tool
-func registerSearchTool(m *server.MCPServer, s *searcher.Searcher) error {
+func registerSearchTool(m *server.MCPServer, s *searcher.Searcher, conversations *conversationStore, usage *usageTracker) error {
 	zap.S().Debugw("registering search tool")
 
 	// Define the tool
@@ -31,14 +48,10 @@ func registerSearchTool(m *server.MCPServer, s *searcher.Searcher) error {
 			mcp.Description("The question to be examined. Formulate the question as a complete sentence in natural language. Questions should not be a list of space-separated keywords. Example: [What are the most contributive biological factors to human civilizational evolution, according to the latest research?]"),
 			mcp.Required(),
 		),
-		mcp.WithNumber("max_token",
-			mcp.Description(fmt.Sprintf("Maximum number of tokens for the response (default: %d)", s.DefaultMaxTokens)),
-		),
-		mcp.WithString("thinking_level",
-			mcp.Description("Thinking level for the model (optional, overrides server default)"),
-			mcp.Enum("MINIMAL", "LOW", "MEDIUM", "HIGH"),
-		),
+		mcp.WithOutputSchema[searcher.SearchResponse](),
 	)
+	addSearchOptionParams(&tool, s)
+	addOutputFormatParam(&tool, s)
 
 	// Add the tool handler
 	m.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -55,45 +68,360 @@ func registerSearchTool(m *server.MCPServer, s *searcher.Searcher) error {
 			return mcp.NewToolResultError("Missing or empty question parameter"), nil
 		}
 
-		// Extract max_token parameter (optional)
-		var maxToken int
-		if maxTokenVal, maxTokenValOK := args["max_token"]; maxTokenValOK {
-			if mt, maxTokenFloatOK := maxTokenVal.(float64); maxTokenFloatOK {
-				maxToken = int(mt)
-			}
+		opts := searchOptionsFromArgs(s, args)
+
+		zap.S().Debugw("executing search",
+			"question", question,
+			"max_token", opts.MaxTokens,
+			"thinking_level", opts.ThinkingLevel,
+			"timeout", opts.Timeout)
+
+		// Perform search
+		response, err := s.Search(ctx, question, opts)
+		if err != nil {
+			zap.S().Errorw("failed to search",
+				"question", question,
+				"error", err)
+			return mcp.NewToolResultError(searchErrorMessage(err)), nil
 		}
+		usage.record(ctx, "search", response)
 
-		var thinkingLevel string
-		if tlVal, ok := args["thinking_level"]; ok {
-			if tl, ok := tlVal.(string); ok {
-				thinkingLevel = tl
-			}
+		// Start a conversation so the answer can be followed up. The history keeps
+		// the plain answer since withHistory lists the sources itself.
+		response.ConversationID = conversations.start(sessionIDFromContext(ctx), searcher.Turn{
+			Question:   question,
+			Answer:     response.Answer(),
+			Groundings: response.Groundings,
+		})
+
+		return searchToolResult(response, outputFormatFromArgs(s, args)), nil
+	})
+
+	return nil
+}
+
+// registerFollowUpTool - Register the follow_up tool
+func registerFollowUpTool(m *server.MCPServer, s *searcher.Searcher, conversations *conversationStore, usage *usageTracker) error {
+	zap.S().Debugw("registering follow_up tool")
+
+	// Define the tool
+	tool := mcp.NewTool("follow_up",
+		mcp.WithDescription("Asks a follow-up question about an earlier search answer. The previous questions, answers and sources of the conversation are sent along, so the question can refer to them without repeating context."),
+		mcp.WithString("conversation_id",
+			mcp.Description("The conversation_id returned by an earlier search or follow_up call"),
+			mcp.Required(),
+		),
+		mcp.WithString("question",
+			mcp.Description("The follow-up question, formulated as a complete sentence in natural language"),
+			mcp.Required(),
+		),
+		mcp.WithOutputSchema[searcher.SearchResponse](),
+	)
+	addSearchOptionParams(&tool, s)
+	addOutputFormatParam(&tool, s)
+
+	// Add the tool handler
+	m.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Extract arguments
+		args := request.GetArguments()
+
+		conversationID, ok := args["conversation_id"].(string)
+		if !ok || conversationID == "" {
+			return mcp.NewToolResultError("Missing or empty conversation_id parameter"), nil
+		}
+		question, ok := args["question"].(string)
+		if !ok || question == "" {
+			return mcp.NewToolResultError("Missing or empty question parameter"), nil
 		}
 
-		zap.S().Debugw("executing search",
+		sessionID := sessionIDFromContext(ctx)
+		history, ok := conversations.history(sessionID, conversationID)
+		if !ok {
+			return mcp.NewToolResultError("Unknown or expired conversation_id. Start a new conversation with the search tool."), nil
+		}
+
+		opts := searchOptionsFromArgs(s, args)
+		opts.History = history
+
+		zap.S().Debugw("executing follow-up search",
+			"conversation_id", conversationID,
 			"question", question,
-			"max_token", maxToken,
-			"thinking_level", thinkingLevel)
+			"history_turns", len(history))
 
 		// Perform search
-		response, err := s.Search(ctx, question, maxToken, thinkingLevel)
+		response, err := s.Search(ctx, question, opts)
 		if err != nil {
-			zap.S().Errorw("failed to search",
+			zap.S().Errorw("failed to search follow-up",
+				"conversation_id", conversationID,
 				"question", question,
 				"error", err)
-			return mcp.NewToolResultError(err.Error()), nil
+			return mcp.NewToolResultError(searchErrorMessage(err)), nil
+		}
+		usage.record(ctx, "follow_up", response)
+
+		conversations.append(sessionID, conversationID, searcher.Turn{
+			Question:   question,
+			Answer:     response.Answer(),
+			Groundings: response.Groundings,
+		})
+		response.ConversationID = conversationID
+
+		return searchToolResult(response, outputFormatFromArgs(s, args)), nil
+	})
+
+	return nil
+}
+
+// batchSearchResult - Outcome of one question in a batch search
+type batchSearchResult struct {
+	Question string                   `json:"question"`
+	Result   *searcher.SearchResponse `json:"result,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// batchSearchResponse - Response of the batch_search tool, in question order
+type batchSearchResponse struct {
+	Results []*batchSearchResult `json:"results"`
+}
+
+// registerBatchSearchTool - Register the batch_search tool
+func registerBatchSearchTool(m *server.MCPServer, s *searcher.Searcher, cfg *config.Config, usage *usageTracker) error {
+	zap.S().Debugw("registering batch_search tool")
+
+	maxQuestions := cfg.Tools.MaxBatchQuestions
+	if maxQuestions <= 0 {
+		maxQuestions = 10 // Default value if not set
+	}
+	concurrency := max(1, cfg.Tools.BatchConcurrency)
+
+	// Define the tool
+	tool := mcp.NewTool("batch_search",
+		mcp.WithDescription("Answers several related questions in one call using Gemini Grounded Search. Questions run concurrently and each one gets its own result or error. Formulate each question as a complete natural language sentence."),
+		mcp.WithArray("questions",
+			mcp.Description(fmt.Sprintf("The questions to be examined (at most %d)", maxQuestions)),
+			mcp.WithStringItems(),
+			mcp.MinItems(1),
+			mcp.MaxItems(maxQuestions),
+			mcp.Required(),
+		),
+	)
+	addSearchOptionParams(&tool, s)
+
+	// Add the tool handler
+	m.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		// Extract arguments
+		args := request.GetArguments()
+
+		// Extract questions parameter
+		questionsVal, ok := args["questions"].([]any)
+		if !ok || len(questionsVal) == 0 {
+			return mcp.NewToolResultError("Missing or empty questions parameter"), nil
+		}
+		if len(questionsVal) > maxQuestions {
+			return mcp.NewToolResultError(fmt.Sprintf("Too many questions: %d (max %d)", len(questionsVal), maxQuestions)), nil
+		}
+		questions := make([]string, len(questionsVal))
+		for i, qv := range questionsVal {
+			q, ok := qv.(string)
+			if !ok || q == "" {
+				return mcp.NewToolResultError(fmt.Sprintf("Question %d is missing or not a string", i+1)), nil
+			}
+			questions[i] = q
 		}
 
+		opts := searchOptionsFromArgs(s, args)
+
+		zap.S().Debugw("executing batch search",
+			"questions", len(questions),
+			"concurrency", concurrency)
+
+		// Perform searches with a bounded worker pool
+		response := &batchSearchResponse{Results: make([]*batchSearchResult, len(questions))}
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, question := range questions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				result := &batchSearchResult{Question: question}
+				res, err := s.Search(ctx, question, opts)
+				if err != nil {
+					zap.S().Errorw("failed to search in batch",
+						"question", question,
+						"error", err)
+					result.Error = searchErrorMessage(err)
+				} else {
+					usage.record(ctx, "batch_search", res)
+					result.Result = res
+				}
+				response.Results[i] = result
+			}()
+		}
+		wg.Wait()
+
 		// Convert response to JSON
-		jsonResponse, err := response.ToJSON()
+		bytes, err := json.Marshal(response)
 		if err != nil {
-			zap.S().Errorw("failed to convert response to JSON",
+			zap.S().Errorw("failed to convert batch response to JSON",
 				"error", err)
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 
-		return mcp.NewToolResultText(jsonResponse), nil
+		return mcp.NewToolResultText(string(bytes)), nil
 	})
 
 	return nil
 }
+
+// searchToolResult - Return a search response as structured content, with a text
+// block rendered in the requested format for clients without output schema support
+func searchToolResult(response *searcher.SearchResponse, format string) *mcp.CallToolResult {
+	text, err := response.Format(format)
+	if err != nil {
+		zap.S().Errorw("failed to format response",
+			"output_format", format,
+			"error", err)
+		return mcp.NewToolResultError(err.Error())
+	}
+	return mcp.NewToolResultStructured(response, text)
+}
+
+// addSearchOptionParams - Add the optional per-search parameters shared by search tools
+func addSearchOptionParams(tool *mcp.Tool, s *searcher.Searcher) {
+	if names := s.TemplateNames(); len(names) > 0 {
+		mcp.WithString("template",
+			mcp.Description(fmt.Sprintf("Named query template that frames the question for Gemini (default: %s)", s.DefaultTemplate)),
+			mcp.Enum(names...),
+		)(tool)
+	}
+
+	for _, opt := range []mcp.ToolOption{
+		mcp.WithString("locale",
+			mcp.Description("Preferred locale for the answer such as en-US or ja-JP, used by query templates that reference it"),
+		),
+		mcp.WithString("context",
+			mcp.Description("Extra background for the question, e.g. what the answer will be used for, used by query templates that reference it"),
+		),
+		mcp.WithNumber("max_token",
+			mcp.Description(fmt.Sprintf("Maximum number of tokens for the response (default: %d)", s.DefaultMaxTokens)),
+		),
+		mcp.WithString("thinking_level",
+			mcp.Description("Thinking level for the model (optional, overrides server default)"),
+			mcp.Enum("MINIMAL", "LOW", "MEDIUM", "HIGH"),
+		),
+		mcp.WithNumber("timeout_seconds",
+			mcp.Description(fmt.Sprintf("Timeout for this search in seconds (default: %d, max: %d). On timeout, consider retrying with a lower thinking_level.", int(s.DefaultTimeout.Seconds()), int(s.MaxTimeout.Seconds()))),
+		),
+		mcp.WithNumber("max_sources",
+			mcp.Description("Maximum number of sources to return, keeping those that support the most of the answer (default: all)"),
+		),
+		mcp.WithArray("include_domains",
+			mcp.Description("Only keep sources from these domains or their subdomains, e.g. [\"who.int\", \"gov\"]"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("exclude_domains",
+			mcp.Description("Remove sources from these domains or their subdomains"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("citations",
+			mcp.Description(fmt.Sprintf("Insert [n] citation markers into the answer and append a numbered reference list matching the groundings (default: %t)", s.DefaultCitations)),
+		),
+	} {
+		opt(tool)
+	}
+}
+
+// addOutputFormatParam - Add the output_format parameter to tools returning a single answer
+func addOutputFormatParam(tool *mcp.Tool, s *searcher.Searcher) {
+	mcp.WithString("output_format",
+		mcp.Description(fmt.Sprintf("Format of the result: json (structured), markdown (answer with a linked Sources list) or text (answer with a plain source list). Default: %s", s.DefaultOutputFormat)),
+		mcp.Enum(config.OutputFormatJSON, config.OutputFormatMarkdown, config.OutputFormatText),
+	)(tool)
+}
+
+// outputFormatFromArgs - Extract the optional output_format parameter, falling back to the server default
+func outputFormatFromArgs(s *searcher.Searcher, args map[string]any) string {
+	if format, ok := args["output_format"].(string); ok && format != "" {
+		return format
+	}
+	return s.DefaultOutputFormat
+}
+
+// searchOptionsFromArgs - Extract the optional per-search parameters from tool arguments
+func searchOptionsFromArgs(s *searcher.Searcher, args map[string]any) searcher.SearchOptions {
+	opts := searcher.SearchOptions{
+		Citations: s.DefaultCitations,
+	}
+
+	// Extract max_token parameter (optional)
+	if maxTokenVal, maxTokenValOK := args["max_token"]; maxTokenValOK {
+		if mt, maxTokenFloatOK := maxTokenVal.(float64); maxTokenFloatOK {
+			opts.MaxTokens = int(mt)
+		}
+	}
+
+	if template, ok := args["template"].(string); ok {
+		opts.Template = template
+	}
+	if locale, ok := args["locale"].(string); ok {
+		opts.Locale = locale
+	}
+	if context, ok := args["context"].(string); ok {
+		opts.Context = context
+	}
+
+	if tlVal, ok := args["thinking_level"]; ok {
+		if tl, ok := tlVal.(string); ok {
+			opts.ThinkingLevel = tl
+		}
+	}
+
+	// Extract timeout_seconds parameter (optional)
+	if timeoutVal, ok := args["timeout_seconds"]; ok {
+		if ts, ok := timeoutVal.(float64); ok && ts > 0 {
+			opts.Timeout = time.Duration(ts * float64(time.Second))
+		}
+	}
+
+	if maxSources, ok := args["max_sources"].(float64); ok && maxSources > 0 {
+		opts.MaxSources = int(maxSources)
+	}
+
+	opts.IncludeDomains = stringsFromArg(args["include_domains"])
+	opts.ExcludeDomains = stringsFromArg(args["exclude_domains"])
+
+	if citations, ok := args["citations"].(bool); ok {
+		opts.Citations = citations
+	}
+
+	return opts
+}
+
+// stringsFromArg - Non-empty strings of an array argument, or nil when absent
+func stringsFromArg(v any) []string {
+	items, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// searchErrorMessage - Tool error text for a failed search
+func searchErrorMessage(err error) string {
+	if errors.Is(err, searcher.ErrSearchTimeout) {
+		return fmt.Sprintf("Timeout: %v. Retry with a lower thinking_level or a larger timeout_seconds.", err)
+	}
+	if errors.Is(err, searcher.ErrBudgetExhausted) {
+		return fmt.Sprintf("%v. Do not retry until the budget resets.", err)
+	}
+	return err.Error()
+}
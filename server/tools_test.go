@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	search "github.com/cnosuke/go-gemini-grounded-search"
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"github.com/cnosuke/mcp-gemini-grounded-search/searcher"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// stubBackend - Backend answering every prompt with a canned answer naming the question
+type stubBackend struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (b *stubBackend) GenerateGroundedContentWithParams(ctx context.Context, params *search.GenerationParams) (*search.Response, error) {
+	b.mu.Lock()
+	b.prompts = append(b.prompts, params.Prompt)
+	b.mu.Unlock()
+
+	lines := strings.Split(strings.TrimSpace(params.Prompt), "\n")
+	text := "Answer to: " + lines[len(lines)-1]
+	return &search.Response{
+		GeneratedText: text,
+		GroundingAttributions: []search.GroundingAttribution{{
+			Title:    "Example",
+			Domain:   "example.com",
+			URL:      "https://example.com/",
+			Segments: []search.GroundingAttributionSegment{{EndIndex: len(text), Text: text}},
+		}},
+	}, nil
+}
+
+func newTestServer(t *testing.T) (*mcpserver.MCPServer, *stubBackend) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Gemini.ModelName = "gemini-test"
+	cfg.Tools.OutputFormat = config.OutputFormatJSON
+	cfg.Tools.MaxBatchQuestions = 5
+	cfg.Tools.BatchConcurrency = 2
+	cfg.Conversations.TTLSeconds = 3600
+	cfg.Conversations.MaxTurns = 10
+	cfg.Conversations.MaxPerSession = 10
+
+	backend := &stubBackend{}
+	s := searcher.NewSearcherWithBackend(backend, cfg)
+	m := mcpserver.NewMCPServer("test", "0.0.0")
+	if err := RegisterAllTools(m, s, cfg, newUsageTracker(cfg)); err != nil {
+		t.Fatalf("RegisterAllTools: %v", err)
+	}
+	return m, backend
+}
+
+// callTool - Call a tool through HandleMessage and return its result
+func callTool(t *testing.T, m *mcpserver.MCPServer, name string, args map[string]any) map[string]any {
+	t.Helper()
+	request, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]any{"name": name, "arguments": args},
+	})
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	bytes, err := json.Marshal(m.HandleMessage(context.Background(), request))
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	var response struct {
+		Result map[string]any `json:"result"`
+		Error  any            `json:"error"`
+	}
+	if err := json.Unmarshal(bytes, &response); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if response.Error != nil {
+		t.Fatalf("%s returned a JSON-RPC error: %v", name, response.Error)
+	}
+	if isError, _ := response.Result["isError"].(bool); isError {
+		t.Fatalf("%s returned a tool error: %v", name, response.Result["content"])
+	}
+	return response.Result
+}
+
+func TestSearchTool(t *testing.T) {
+	m, backend := newTestServer(t)
+
+	result := callTool(t, m, "search", map[string]any{"question": "What is Go?"})
+	structured, _ := result["structuredContent"].(map[string]any)
+	if text := structured["text"]; text != "Answer to: What is Go?" {
+		t.Errorf("search text = %v", text)
+	}
+	if groundings, _ := structured["groundings"].([]any); len(groundings) != 1 {
+		t.Errorf("search groundings = %v", structured["groundings"])
+	}
+	if len(backend.prompts) != 1 {
+		t.Errorf("backend received %d prompts, want 1", len(backend.prompts))
+	}
+}
+
+func TestFollowUpTool(t *testing.T) {
+	m, backend := newTestServer(t)
+
+	result := callTool(t, m, "search", map[string]any{"question": "What is Go?"})
+	structured, _ := result["structuredContent"].(map[string]any)
+	conversationID, _ := structured["conversation_id"].(string)
+	if conversationID == "" {
+		t.Fatalf("search returned no conversation_id")
+	}
+
+	result = callTool(t, m, "follow_up", map[string]any{
+		"conversation_id": conversationID,
+		"question":        "Who designed it?",
+	})
+	structured, _ = result["structuredContent"].(map[string]any)
+	if text := structured["text"]; text != "Answer to: Who designed it?" {
+		t.Errorf("follow_up text = %v", text)
+	}
+	if structured["conversation_id"] != conversationID {
+		t.Errorf("follow_up conversation_id = %v, want %s", structured["conversation_id"], conversationID)
+	}
+	if prompt := backend.prompts[len(backend.prompts)-1]; !strings.Contains(prompt, "<question>What is Go?</question>") {
+		t.Errorf("follow_up prompt has no history: %q", prompt)
+	}
+}
+
+func TestFollowUpHistoryWithoutCitations(t *testing.T) {
+	m, backend := newTestServer(t)
+
+	result := callTool(t, m, "search", map[string]any{"question": "What is Go?", "citations": true})
+	structured, _ := result["structuredContent"].(map[string]any)
+	if text, _ := structured["text"].(string); !strings.Contains(text, "References:") {
+		t.Fatalf("search text has no citations: %q", text)
+	}
+
+	callTool(t, m, "follow_up", map[string]any{
+		"conversation_id": structured["conversation_id"],
+		"question":        "Who designed it?",
+	})
+	prompt := backend.prompts[len(backend.prompts)-1]
+	if !strings.Contains(prompt, "<answer>Answer to: What is Go?</answer>") || strings.Contains(prompt, "References:") {
+		t.Errorf("follow_up history does not hold the plain answer: %q", prompt)
+	}
+}
+
+func TestBatchSearchTool(t *testing.T) {
+	m, _ := newTestServer(t)
+
+	result := callTool(t, m, "batch_search", map[string]any{"questions": []string{"Q1", "Q2", "Q3"}})
+	content, _ := result["content"].([]any)
+	if len(content) != 1 {
+		t.Fatalf("batch_search content = %v", result["content"])
+	}
+	block, _ := content[0].(map[string]any)
+	var batch batchSearchResponse
+	if err := json.Unmarshal([]byte(fmt.Sprint(block["text"])), &batch); err != nil {
+		t.Fatalf("unmarshal batch_search result: %v", err)
+	}
+	if len(batch.Results) != 3 {
+		t.Fatalf("batch_search returned %d results, want 3", len(batch.Results))
+	}
+	for i, r := range batch.Results {
+		want := fmt.Sprintf("Q%d", i+1)
+		if r.Question != want || r.Error != "" || r.Result == nil || r.Result.Text != "Answer to: "+want {
+			t.Errorf("batch_search result %d = %+v", i, r)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+	"github.com/cnosuke/mcp-gemini-grounded-search/searcher"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// sessionUsageIdleTimeout - Sessions without searches for this long are dropped
+// from the aggregates, for clients that never close their session
+const sessionUsageIdleTimeout = 24 * time.Hour
+
+// usageTotals - Aggregated usage of a set of searches
+type usageTotals struct {
+	Requests       int64 `json:"requests"`
+	CachedRequests int64 `json:"cached_requests"`
+	// CoalescedRequests joined another caller's identical in-flight search
+	CoalescedRequests int64 `json:"coalesced_requests"`
+	PromptTokens      int64 `json:"prompt_tokens"`
+	CandidatesTokens  int64 `json:"candidates_tokens"`
+	ThinkingTokens    int64 `json:"thinking_tokens"`
+	TotalTokens       int64 `json:"total_tokens"`
+	LatencyMs         int64 `json:"latency_ms"`
+}
+
+// add - Count one response. Cached and coalesced responses add no tokens since
+// this caller made no Gemini call; coalesced tokens count for the caller that did.
+func (t *usageTotals) add(response *searcher.SearchResponse) {
+	t.Requests++
+	if response.Cached {
+		t.CachedRequests++
+		return
+	}
+	if response.Coalesced {
+		t.CoalescedRequests++
+		return
+	}
+	if u := response.Usage; u != nil {
+		t.PromptTokens += int64(u.PromptTokens)
+		t.CandidatesTokens += int64(u.CandidatesTokens)
+		t.ThinkingTokens += int64(u.ThinkingTokens)
+		t.TotalTokens += int64(u.TotalTokens)
+		t.LatencyMs += u.LatencyMs
+	}
+}
+
+// sessionUsage - Usage of one MCP session
+type sessionUsage struct {
+	// SessionID is replaced by its digest in reports, since knowing a session ID
+	// is enough to read that session's conversations
+	SessionID string    `json:"session"`
+	Client    string    `json:"client,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	usageTotals
+}
+
+// dayUsage - Usage of one UTC day
+type dayUsage struct {
+	Date string `json:"date"`
+	usageTotals
+}
+
+// usageReport - Snapshot of aggregated usage served by the /usage endpoint
+type usageReport struct {
+	Sessions []*sessionUsage `json:"sessions"`
+	Days     []*dayUsage     `json:"days"`
+}
+
+// usageTracker - In-memory usage aggregates per MCP session and per UTC day
+type usageTracker struct {
+	retentionDays int
+
+	mu       sync.Mutex
+	sessions map[string]*sessionUsage
+	days     map[string]*dayUsage
+}
+
+func newUsageTracker(cfg *config.Config) *usageTracker {
+	return &usageTracker{
+		retentionDays: cfg.Usage.RetentionDays,
+		sessions:      map[string]*sessionUsage{},
+		days:          map[string]*dayUsage{},
+	}
+}
+
+// record - Add a search response to the aggregates of the calling session and today
+func (t *usageTracker) record(ctx context.Context, tool string, response *searcher.SearchResponse) {
+	now := time.Now()
+	sessionID := sessionIDFromContext(ctx)
+	client := clientNameFromContext(ctx)
+
+	t.mu.Lock()
+	su, ok := t.sessions[sessionID]
+	if !ok {
+		t.pruneSessions(now)
+		su = &sessionUsage{SessionID: sessionID, Client: client, StartedAt: now}
+		t.sessions[sessionID] = su
+	}
+	su.LastSeen = now
+	su.add(response)
+
+	date := now.UTC().Format(time.DateOnly)
+	du, ok := t.days[date]
+	if !ok {
+		du = &dayUsage{Date: date}
+		t.days[date] = du
+		t.pruneDays(now)
+	}
+	du.add(response)
+	sessionTotal, dayTotal := su.TotalTokens, du.TotalTokens
+	t.mu.Unlock()
+
+	u := response.Usage
+	if u == nil {
+		u = &searcher.Usage{}
+	}
+	zap.S().Infow("search usage",
+		"tool", tool,
+		"session_id", sessionID,
+		"client", client,
+		"model", u.Model,
+		"cached", response.Cached,
+		"coalesced", response.Coalesced,
+		"prompt_tokens", u.PromptTokens,
+		"candidates_tokens", u.CandidatesTokens,
+		"thinking_tokens", u.ThinkingTokens,
+		"total_tokens", u.TotalTokens,
+		"latency_ms", u.LatencyMs,
+		"session_total_tokens", sessionTotal,
+		"day_total_tokens", dayTotal)
+}
+
+// endSession - Log the final usage of a session and forget it
+func (t *usageTracker) endSession(sessionID string) {
+	t.mu.Lock()
+	su, ok := t.sessions[sessionID]
+	delete(t.sessions, sessionID)
+	t.mu.Unlock()
+
+	if ok {
+		logSessionUsage(su)
+	}
+}
+
+// pruneSessions - Drop sessions idle for longer than sessionUsageIdleTimeout. Caller holds mu.
+func (t *usageTracker) pruneSessions(now time.Time) {
+	for id, su := range t.sessions {
+		if now.Sub(su.LastSeen) > sessionUsageIdleTimeout {
+			delete(t.sessions, id)
+			logSessionUsage(su)
+		}
+	}
+}
+
+// logSessionUsage - Log the totals of a session that ended or went idle
+func logSessionUsage(su *sessionUsage) {
+	zap.S().Infow("session usage",
+		"session_id", su.SessionID,
+		"client", su.Client,
+		"started_at", su.StartedAt,
+		"requests", su.Requests,
+		"cached_requests", su.CachedRequests,
+		"coalesced_requests", su.CoalescedRequests,
+		"total_tokens", su.TotalTokens,
+		"thinking_tokens", su.ThinkingTokens)
+}
+
+// pruneDays - Drop days older than retentionDays. Caller holds mu.
+func (t *usageTracker) pruneDays(now time.Time) {
+	if t.retentionDays <= 0 {
+		return
+	}
+	cutoff := now.UTC().AddDate(0, 0, -t.retentionDays).Format(time.DateOnly)
+	for date := range t.days {
+		if date < cutoff {
+			delete(t.days, date)
+		}
+	}
+}
+
+// snapshot - Copy of the current aggregates, sessions by start time and days by date
+func (t *usageTracker) snapshot() *usageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := &usageReport{
+		Sessions: make([]*sessionUsage, 0, len(t.sessions)),
+		Days:     make([]*dayUsage, 0, len(t.days)),
+	}
+	for _, su := range t.sessions {
+		c := *su
+		c.SessionID = sessionDigest(su.SessionID)
+		report.Sessions = append(report.Sessions, &c)
+	}
+	for _, du := range t.days {
+		c := *du
+		report.Days = append(report.Days, &c)
+	}
+	sort.Slice(report.Sessions, func(i, j int) bool {
+		return report.Sessions[i].StartedAt.Before(report.Sessions[j].StartedAt)
+	})
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Date < report.Days[j].Date
+	})
+	return report
+}
+
+// sessionDigest - Short stable identifier of a session that cannot be used as its ID
+func sessionDigest(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:6])
+}
+
+// handleUsage - Serve the usage report as JSON
+func (t *usageTracker) handleUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(t.snapshot()); err != nil {
+		zap.S().Errorw("failed to write usage report", "error", err)
+	}
+}
+
+// clientNameFromContext - Name reported by the MCP client at initialization, or "" when unknown
+func clientNameFromContext(ctx context.Context) string {
+	session, ok := mcpserver.ClientSessionFromContext(ctx).(mcpserver.SessionWithClientInfo)
+	if !ok {
+		return ""
+	}
+	info := session.GetClientInfo()
+	if info.Version != "" {
+		return info.Name + "/" + info.Version
+	}
+	return info.Name
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnosuke/mcp-gemini-grounded-search/config"
+)
+
+func TestUsageReportHidesSessionIDs(t *testing.T) {
+	tracker := newUsageTracker(&config.Config{})
+	const sessionID = "mcp-session-0123456789"
+	tracker.sessions[sessionID] = &sessionUsage{SessionID: sessionID, StartedAt: time.Now(), LastSeen: time.Now()}
+
+	report := tracker.snapshot()
+	if len(report.Sessions) != 1 {
+		t.Fatalf("report has %d sessions, want 1", len(report.Sessions))
+	}
+	if got := report.Sessions[0].SessionID; got != sessionDigest(sessionID) {
+		t.Errorf("reported session = %q, want its digest", got)
+	}
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("marshal report: %v", err)
+	}
+	if strings.Contains(string(bytes), sessionID) {
+		t.Errorf("report exposes the session ID: %s", bytes)
+	}
+	if tracker.sessions[sessionID].SessionID != sessionID {
+		t.Errorf("snapshot changed the tracked session")
+	}
+}